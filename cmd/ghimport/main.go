@@ -0,0 +1,57 @@
+// Command ghimport imports the teams of a GitHub organization, the same way
+// POST /org/importGitHub does.
+//
+//	DATABASE_URL=postgres://... GITHUB_TOKEN=... ghimport -org acme [-api-url https://ghe.example.com/api/v3]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"ex8ed/pullreq-assigner/internal/github"
+	"ex8ed/pullreq-assigner/internal/service"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+func main() {
+	org := flag.String("org", "", "GitHub organization")
+	apiURL := flag.String("api-url", os.Getenv("GITHUB_API_URL"), "GitHub API base URL")
+	flag.Parse()
+
+	if *org == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal("Could not connect to DB:", err)
+	}
+	defer db.Close()
+
+	svc := service.New(storage.New(db), service.Config{
+		GitHub: github.NewClient(*apiURL, os.Getenv("GITHUB_TOKEN")),
+	})
+
+	res, err := svc.ImportGitHubOrg(context.Background(), *org)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Imported %d teams.\n", len(res.Teams))
+	for _, name := range res.CreatedTeams {
+		fmt.Println("created team", name)
+	}
+	for _, id := range res.CreatedUsers {
+		fmt.Println("created user", id)
+	}
+	for _, name := range res.SkippedTeams {
+		fmt.Println("skipped archived team", name)
+	}
+}
@@ -0,0 +1,82 @@
+// Command orgsync brings teams and members in the database in line with an
+// org file, the same way POST /org/sync does.
+//
+//	DATABASE_URL=postgres://... orgsync -file org.csv [-apply] [-prune]
+//
+// Without -apply it only prints the plan.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"ex8ed/pullreq-assigner/internal/service"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+func main() {
+	file := flag.String("file", "", "org file in CSV")
+	apply := flag.Bool("apply", false, "apply the plan")
+	prune := flag.Bool("prune", false, "archive teams missing from the file")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	spec, err := service.ParseOrgCSV(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sqlx.Connect("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal("Could not connect to DB:", err)
+	}
+	defer db.Close()
+
+	svc := service.New(storage.New(db), service.Config{})
+
+	res, err := svc.SyncOrg(context.Background(), spec, *apply, *prune)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(res.Plan) == 0 {
+		fmt.Println("No changes.")
+		return
+	}
+
+	for _, c := range res.Plan {
+		line := c.Action
+		if c.Team != "" {
+			line += " team=" + c.Team
+		}
+		if c.UserID != "" {
+			line += " user=" + c.UserID
+		}
+		if c.Detail != "" {
+			line += " (" + c.Detail + ")"
+		}
+		fmt.Println(line)
+	}
+
+	if res.Applied {
+		fmt.Printf("Applied %d changes.\n", len(res.Plan))
+	} else {
+		fmt.Println("Dry run; use -apply to make these changes.")
+	}
+}
@@ -3,6 +3,6 @@ module ex8ed/pullreq-assigner
 go 1.25.4
 
 require (
-	github.com/jmoiron/sqlx v1.4.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/jmoiron/sqlx v1.4.0
+	github.com/lib/pq v1.10.9
 )
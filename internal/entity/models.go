@@ -1,19 +1,93 @@
 package entity
 
-import "time"
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
 
 
 type User struct {
 	ID 			string 		`json:"user_id" db:"id"`
 	Username 	string 		`json:"username" db:"username"`
 	IsActive 	bool 		`json:"is_active" db:"is_active"`
-	TeamName 	string 		`json:"team_name" db:"team_name"`
+	UserRole	string 		`json:"user_role" db:"user_role"`
+
+	// TeamName is the user's home team, the first one they joined. In team
+	// member lists it is the listed team.
+	TeamName 	string 			`json:"team_name" db:"team_name"`
+	Teams		pq.StringArray 	`json:"teams,omitempty" db:"teams"`
+
+	// IsOnboarding mirrors the onboarding team role in the same team as
+	// TeamName.
+	IsOnboarding	bool 		`json:"is_onboarding" db:"is_onboarding"`
+
+	// DepartedAt is set once the user has been offboarded. Some time later
+	// their ID and username are replaced with a pseudonym.
+	DepartedAt	*time.Time 		`json:"departed_at,omitempty" db:"departed_at"`
+}
+
+
+// TeamMember is a user together with their membership in one team.
+type TeamMember struct {
+	User
+	TeamRole	string 		`json:"team_role" db:"team_role"`
+
+	// Weight scales how many reviews the member gets relative to others.
+	Weight		int 		`json:"weight" db:"weight"`
+}
+
+
+type TeamSettings struct {
+	FirstResponseSLA	int 		`json:"first_response_sla_minutes" db:"first_response_sla_minutes"`
+	VerdictSLA			int 		`json:"verdict_sla_minutes" db:"verdict_sla_minutes"`
+	SLAPolicy			string 		`json:"sla_policy" db:"sla_policy"`
+	ReviewersCount		int 		`json:"reviewers_count" db:"reviewers_count"`
+	RequiredApprovals	int 		`json:"required_approvals" db:"required_approvals"`
+	StaleApprovals		string 		`json:"stale_approvals" db:"stale_approvals"`
+	AssignmentStrategy	string 		`json:"assignment_strategy" db:"assignment_strategy"`
+	AssignmentMode		string 		`json:"assignment_mode" db:"assignment_mode"`
+	PoolTimeout			int 		`json:"pool_timeout_minutes" db:"pool_timeout_minutes"`
+	ShadowShare			int 		`json:"shadow_share_percent" db:"shadow_share_percent"`
 }
 
 
 type Team struct {
-	Name		string 		`json:"team_name" db:"name"`
-	Members 	[]User 		`json:"members" db:"-"`
+	Name			string 					`json:"team_name" db:"name"`
+	TeamSettings 							`json:"settings"`
+	Members 		[]TeamMember 			`json:"members" db:"-"`
+	Repositories	[]RepositorySettings 	`json:"repositories,omitempty" db:"-"`
+
+	// ArchivedAt is set for archived teams, which take no part in assignment.
+	ArchivedAt		*time.Time 				`json:"archived_at,omitempty" db:"archived_at"`
+
+	// ParentTeam is where assignment escalates when the team has no
+	// candidates.
+	ParentTeam		*string 				`json:"parent_team,omitempty" db:"parent_team"`
+
+	// Subteams and Summary are only filled when the subtree is requested.
+	Subteams		[]Team 					`json:"subteams,omitempty" db:"-"`
+	Summary			*TeamSummary 			`json:"summary,omitempty" db:"-"`
+}
+
+
+// TeamSummary aggregates a team together with all of its subteams. Users in
+// several of these teams are counted once.
+type TeamSummary struct {
+	Teams			int 		`json:"teams"`
+	Members			int 		`json:"members"`
+	ActiveMembers	int 		`json:"active_members"`
+	OpenReviews		int 		`json:"open_reviews"`
+}
+
+
+// RepositorySettings overrides team settings for PRs of one repository.
+// Nil fields fall back to the team value.
+type RepositorySettings struct {
+	TeamName		string 		`json:"team_name" db:"team_name"`
+	Repository		string 		`json:"repository" db:"repository"`
+	ReviewersCount	*int 		`json:"reviewers_count,omitempty" db:"reviewers_count"`
+	Strategy		*string 	`json:"assignment_strategy,omitempty" db:"assignment_strategy"`
 }
 
 
@@ -22,15 +96,255 @@ type PullRequest struct {
 	Name 		string 		`json:"pull_request_name" db:"name"`
 	AuthorID 	string 		`json:"author_id" db:"author_id"`
 	Status		string 		`json:"status" db:"status"`
+	TeamName	string 		`json:"team_name" db:"team_name"`
+	Version		int 		`json:"version" db:"version"`
+	ParentID	*string 	`json:"parent_id,omitempty" db:"parent_id"`
+	HeadSHA		string 		`json:"head_sha,omitempty" db:"head_sha"`
+	ReviewRound	int 		`json:"review_round" db:"review_round"`
+	Priority	string 		`json:"priority" db:"priority"`
+
+	Repository		string 			`json:"repository,omitempty" db:"repository"`
+	Number			*int 			`json:"number,omitempty" db:"number"`
+	SourceBranch	string 			`json:"source_branch,omitempty" db:"source_branch"`
+	TargetBranch	string 			`json:"target_branch,omitempty" db:"target_branch"`
+	URL				string 			`json:"url,omitempty" db:"url"`
+	Labels			pq.StringArray 	`json:"labels" db:"labels"`
 
 	CreatedAt 	time.Time 	`json:"created_at" db:"created_at"`
 	MergedAt	*time.Time 	`json:"merged_at,omitempty" db:"merged_at"`
+	ClosedAt	*time.Time 	`json:"closed_at,omitempty" db:"closed_at"`
+	PooledAt	*time.Time 	`json:"pooled_at,omitempty" db:"pooled_at"`
 
-	Reviewers	[]User 		`json:"assigned_reviewers" db:"-"`
+	Author		*User 		`json:"author,omitempty" db:"author"`
+	Reviewers	[]Reviewer 	`json:"assigned_reviewers" db:"-"`
+}
+
+
+// Reviewer is a user assigned to a PR together with the assignment state.
+type Reviewer struct {
+	User
+	Role			string 		`json:"role" db:"role"`
+	ReviewState		string 		`json:"review_state" db:"review_state"`
+	ApprovedSHA		*string 	`json:"approved_sha,omitempty" db:"approved_sha"`
+	AssignedAt		time.Time 	`json:"assigned_at" db:"assigned_at"`
+	ReviewDeadline
 }
 
 
 type PRReviewerPair struct {
+	PRID			string 		`json:"pull_request_id" db:"pull_request_id"`
+	UserID			string 		`json:"user_id" db:"user_id"`
+	Role			string 		`json:"role" db:"role"`
+	State			string 		`json:"state" db:"state"`
+	ApprovedSHA		*string 	`json:"approved_sha,omitempty" db:"approved_sha"`
+	ReviewRound		int 		`json:"review_round" db:"review_round"`
+	AssignedAt		time.Time 	`json:"assigned_at" db:"assigned_at"`
+	RespondedAt		*time.Time 	`json:"responded_at,omitempty" db:"responded_at"`
+	EscalatedAt		*time.Time 	`json:"escalated_at,omitempty" db:"escalated_at"`
+	ReviewDeadline
+}
+
+
+// UserReview is a PR as seen by one of its reviewers.
+type UserReview struct {
+	PullRequest
+	ReviewState		string 		`json:"review_state" db:"review_state"`
+	ReviewRole		string 		`json:"review_role" db:"review_role"`
+	OwesReview		bool 		`json:"owes_review" db:"-"`
+}
+
+
+const (
+	SLAPolicyNotify			= "notify"
+	SLAPolicyAddReviewer	= "add_reviewer"
+	SLAPolicyReassign		= "reassign"
+)
+
+
+const (
+	ReviewPending			= "PENDING"
+	ReviewCommented			= "COMMENTED"
+	ReviewApproved			= "APPROVED"
+	ReviewChangesRequested	= "CHANGES_REQUESTED"
+	ReviewStale				= "STALE"
+)
+
+
+const (
+	StrategyRandom			= "random"
+	StrategyLeastLoaded		= "least_loaded"
+)
+
+
+const (
+	ModeAuto				= "auto"
+	ModePool				= "pool"
+)
+
+
+// User roles. Bots are never chosen as reviewers; leads are picked only when
+// nobody else up the team hierarchy is available.
+const (
+	UserRoleMember			= "member"
+	UserRoleLead			= "lead"
+	UserRoleBot				= "bot"
+)
+
+
+// What happens to PRs authored by bots.
+const (
+	BotPRsAssign			= "assign"
+	BotPRsPool				= "pool"
+	BotPRsNone				= "none"
+)
+
+
+// Membership roles. Onboarding members only join reviews as shadows.
+const (
+	TeamRoleMember			= "member"
+	TeamRoleOnboarding		= "onboarding"
+)
+
+
+// What happens to the open reviews of a member removed from a team.
+const (
+	MemberReviewsKeep		= "keep"
+	MemberReviewsReassign	= "reassign"
+)
+
+
+// What happens to the open PRs authored by a user moved to another team.
+const (
+	AuthoredPRsKeep			= "keep"
+	AuthoredPRsMove			= "move"
+)
+
+
+// TeamTransfer records a user moving between teams. Team names are empty when
+// the user had no team or the team was deleted since.
+type TeamTransfer struct {
+	ID				int64 		`json:"id" db:"id"`
+	UserID			string 		`json:"user_id" db:"user_id"`
+	FromTeam		string 		`json:"from_team" db:"from_team"`
+	ToTeam			string 		`json:"to_team" db:"to_team"`
+	ReviewPolicy	string 		`json:"review_policy" db:"review_policy"`
+	PRPolicy		string 		`json:"pr_policy" db:"pr_policy"`
+	CreatedAt		time.Time 	`json:"created_at" db:"created_at"`
+}
+
+
+// Reviewer roles. Only required reviewers get SLA deadlines; shadows do not
+// count toward approvals or load.
+const (
+	RoleRequired			= "required"
+	RoleOptional			= "optional"
+	RoleShadow				= "shadow"
+)
+
+
+const (
+	PriorityLow			= "low"
+	PriorityNormal		= "normal"
+	PriorityUrgent		= "urgent"
+)
+
+
+type ReviewLoad struct {
+	UserID		string 		`db:"user_id"`
+	OpenReviews	int 		`db:"open_reviews"`
+}
+
+
+type ReviewerStats struct {
+	UserID			string 	`json:"user_id" db:"user_id"`
+	OpenReviews		int 	`json:"open_reviews" db:"open_reviews"`
+	Approvals		int 	`json:"approvals" db:"approvals"`
+	Declines		int 	`json:"declines" db:"declines"`
+	DeclinesLastDay	int 	`json:"declines_last_day" db:"declines_last_day"`
+}
+
+
+const (
+	StaleApprovalsDismiss	= "dismiss"
+	StaleApprovalsKeep		= "keep"
+)
+
+
+type ReviewDeadline struct {
+	ResponseDueAt	*time.Time 	`json:"response_due_at,omitempty" db:"response_due_at"`
+	VerdictDueAt	*time.Time 	`json:"verdict_due_at,omitempty" db:"verdict_due_at"`
+}
+
+
+type OverdueReview struct {
 	PRID		string 		`db:"pull_request_id"`
 	UserID		string 		`db:"user_id"`
+	AuthorID	string 		`db:"author_id"`
+	TeamName	string 		`db:"team_name"`
+	SLAPolicy	string 		`db:"sla_policy"`
+}
+
+
+const (
+	ReasonUnavailable	= "unavailable"
+	ReasonLacksContext	= "lacks_context"
+	ReasonConflict		= "conflict_of_interest"
+	ReasonWorkload		= "workload"
+	ReasonOther			= "other"
+	ReasonSLAOverdue	= "sla_overdue"
+	ReasonDeactivated	= "deactivated"
+	ReasonLeftTeam		= "left_team"
+	ReasonTransferred	= "transferred"
+	ReasonOffboarded	= "offboarded"
+)
+
+
+type Reassignment struct {
+	ID			int64 		`json:"id" db:"id"`
+	PRID		string 		`json:"pull_request_id" db:"pull_request_id"`
+	OldUserID	string 		`json:"old_user_id" db:"old_user_id"`
+	NewUserID	string 		`json:"new_user_id" db:"new_user_id"`
+	Reason		string 		`json:"reason" db:"reason"`
+	Comment		string 		`json:"comment,omitempty" db:"comment"`
+	CreatedAt	time.Time 	`json:"created_at" db:"created_at"`
+	UndoneAt	*time.Time 	`json:"undone_at,omitempty" db:"undone_at"`
+	Declined	bool 		`json:"declined" db:"declined"`
+
+	// Previous is the replaced reviewer's assignment, kept so that the
+	// reassignment can be undone.
+	Previous	*PRReviewerPair 	`json:"-" db:"-"`
 }
+
+
+type PRFilter struct {
+	Status			string
+	AuthorID		string
+	TeamName		string
+	ReviewerID		string
+	Repository		string
+	Label			string
+	CreatedFrom		*time.Time
+	CreatedTo		*time.Time
+
+	SortBy			string
+	Desc			bool
+	Limit			int
+
+	// After is the sort key of the last PR of the previous page.
+	After			*PRCursor
+}
+
+
+// PRCursor is only valid for the sort it was issued for.
+type PRCursor struct {
+	SortBy		string 		`json:"s"`
+	Desc		bool 		`json:"d,omitempty"`
+	Value		string 		`json:"v"`
+	ID			string 		`json:"id"`
+}
+
+
+const (
+	SortByCreatedAt		= "created_at"
+	SortByName			= "name"
+)
@@ -0,0 +1,246 @@
+// Package github reads organization teams and their members through the
+// GitHub REST API.
+package github
+
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+const (
+	DefaultBaseURL = "https://api.github.com"
+
+	pageSize = 100
+
+	// maxRetries bounds how many times one request is retried after hitting
+	// the rate limit.
+	maxRetries = 3
+)
+
+
+type Team struct {
+	Slug	string 		`json:"slug"`
+	Name	string 		`json:"name"`
+	Parent	*Team 		`json:"parent"`
+}
+
+
+type Member struct {
+	Login	string 		`json:"login"`
+	ID		int64 		`json:"id"`
+
+	// Type is "User" or "Bot".
+	Type	string 		`json:"type"`
+}
+
+
+// APIError is a non-successful response of the API.
+type APIError struct {
+	StatusCode	int
+	Message		string
+}
+
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("github: %d %s", e.StatusCode, e.Message)
+}
+
+
+type Client struct {
+	baseURL	string
+	token	string
+	http	*http.Client
+
+	// MaxWait caps how long the client waits for the rate limit to reset;
+	// a longer wait fails the request instead.
+	MaxWait	time.Duration
+
+	// sleep waits for d unless ctx is done first; replaced in tests.
+	sleep	func(ctx context.Context, d time.Duration) error
+
+	// resetAt is when the exhausted rate limit resets, zero otherwise.
+	resetAt	time.Time
+}
+
+
+// NewClient returns a client for the API at baseURL, DefaultBaseURL when
+// empty. The token may be empty for public data.
+func NewClient(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+		MaxWait: 15 * time.Minute,
+		sleep:   sleepContext,
+	}
+}
+
+
+// ListTeams returns all teams of the organization.
+func (c *Client) ListTeams(ctx context.Context, org string) ([]Team, error) {
+	return listAll[Team](ctx, c, fmt.Sprintf("/orgs/%s/teams", url.PathEscape(org)))
+}
+
+
+// ListTeamMembers returns the members of a team, including members of its
+// child teams as GitHub does.
+func (c *Client) ListTeamMembers(ctx context.Context, org, teamSlug string) ([]Member, error) {
+	return listAll[Member](ctx, c, fmt.Sprintf("/orgs/%s/teams/%s/members",
+		url.PathEscape(org), url.PathEscape(teamSlug)))
+}
+
+
+// listAll fetches every page of a list endpoint, following the Link header.
+func listAll[T any](ctx context.Context, c *Client, path string) ([]T, error) {
+	next := fmt.Sprintf("%s%s?per_page=%d", c.baseURL, path, pageSize)
+
+	items := make([]T, 0)
+	for next != "" {
+		resp, err := c.get(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []T
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("github: decoding %s: %w", next, err)
+		}
+
+		items = append(items, page...)
+		next = nextLink(resp.Header.Get("Link"))
+	}
+	return items, nil
+}
+
+
+// get performs a GET request. When the rate limit is exhausted it waits for
+// the reset and retries.
+func (c *Client) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForReset(ctx); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		limited := c.trackRateLimit(resp)
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		apiErr := readAPIError(resp)
+		if !limited || attempt >= maxRetries {
+			return nil, apiErr
+		}
+	}
+}
+
+
+// trackRateLimit records when to resume after resp and reports whether resp
+// was rejected because of the rate limit.
+func (c *Client) trackRateLimit(resp *http.Response) bool {
+	h := resp.Header
+
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			c.resetAt = time.Now().Add(time.Duration(secs) * time.Second)
+			return resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+		}
+	}
+
+	if h.Get("X-RateLimit-Remaining") != "0" {
+		return false
+	}
+	if secs, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		c.resetAt = time.Unix(secs, 0)
+	}
+	return resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests
+}
+
+
+func (c *Client) waitForReset(ctx context.Context) error {
+	if c.resetAt.IsZero() {
+		return nil
+	}
+
+	wait := time.Until(c.resetAt)
+	c.resetAt = time.Time{}
+	if wait <= 0 {
+		return nil
+	}
+	if wait > c.MaxWait {
+		return fmt.Errorf("github: rate limit resets in %s", wait.Round(time.Second))
+	}
+	return c.sleep(ctx, wait)
+}
+
+
+func readAPIError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Message == "" {
+		payload.Message = http.StatusText(resp.StatusCode)
+	}
+	return &APIError{StatusCode: resp.StatusCode, Message: payload.Message}
+}
+
+
+var linkNextRe = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="next"`)
+
+
+// nextLink returns the rel="next" URL of a Link header, "" on the last page.
+func nextLink(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		if m := linkNextRe.FindStringSubmatch(part); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+
+func TestListTeamMembersPagination(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/orgs/acme/teams/core/members" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/acme/teams/core/members?per_page=100&page=2>; rel="next", <%[1]s/orgs/acme/teams/core/members?per_page=100&page=2>; rel="last"`, srv.URL))
+			fmt.Fprint(w, `[{"login": "alice", "id": 1, "type": "User"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"login": "ci-bot", "id": 2, "type": "Bot"}]`)
+		}
+	}))
+	defer srv.Close()
+
+	members, err := NewClient(srv.URL, "secret").ListTeamMembers(context.Background(), "acme", "core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].Login != "alice" || members[1].Type != "Bot" {
+		t.Errorf("unexpected members: %+v", members)
+	}
+}
+
+
+func TestRateLimitRetry(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+			return
+		}
+		fmt.Fprint(w, `[{"slug": "core", "name": "Core"}, {"slug": "web", "name": "Web", "parent": {"slug": "core"}}]`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "")
+	var waited time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		waited += d
+		return nil
+	}
+
+	teams, err := c.ListTeams(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || waited < 30*time.Second {
+		t.Errorf("expected one retry after waiting for the reset, got %d requests and %s", requests, waited)
+	}
+	if len(teams) != 2 || teams[1].Parent == nil || teams[1].Parent.Slug != "core" {
+		t.Errorf("unexpected teams: %+v", teams)
+	}
+}
+
+
+func TestRateLimitTooLong(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "")
+	c.MaxWait = time.Minute
+
+	if _, err := c.ListTeams(context.Background(), "acme"); err == nil {
+		t.Fatal("expected an error when the rate limit resets too late")
+	}
+}
+
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, "").ListTeams(context.Background(), "missing")
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Not Found" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"ex8ed/pullreq-assigner/internal/entity"
 	"ex8ed/pullreq-assigner/internal/service"
@@ -33,10 +35,11 @@ func (h *Handler) respondJSON(w http.ResponseWriter, status int, payload interfa
 	}
 }
 
-func (h *Handler) respondError(w http.ResponseWriter, err error) {
-	statusCode := http.StatusInternalServerError
-	msg := "internal server error"
-	appCode := "ERROR"
+// errorInfo maps err to an HTTP status, application code and message.
+func errorInfo(err error) (statusCode int, appCode, msg string) {
+	statusCode = http.StatusInternalServerError
+	msg = "internal server error"
+	appCode = "ERROR"
 	switch {
 	case errors.Is(err, storage.ErrNotFound):
 		statusCode = http.StatusNotFound
@@ -53,6 +56,11 @@ func (h *Handler) respondError(w http.ResponseWriter, err error) {
 		appCode = "PR_MERGED"
 		msg = "cannot edit merged PR"
 
+	case errors.Is(err, service.ErrPRClosed):
+		statusCode = http.StatusConflict
+		appCode = "PR_CLOSED"
+		msg = "cannot edit closed PR"
+
 	case errors.Is(err, service.ErrNotAssigned):
 		statusCode = http.StatusConflict
 		appCode = "NOT_ASSIGNED"
@@ -62,16 +70,160 @@ func (h *Handler) respondError(w http.ResponseWriter, err error) {
 		statusCode = http.StatusConflict
 		appCode = "NO_CANDIDATE"
 		msg = "no active replacement candidate in team"
+
+	case errors.Is(err, service.ErrNotCandidate):
+		statusCode = http.StatusConflict
+		appCode = "NOT_CANDIDATE"
+		msg = "user cannot be assigned as reviewer"
+
+	case errors.Is(err, service.ErrInvalidReason):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_REASON"
+		msg = "unknown reassignment reason"
+
+	case errors.Is(err, service.ErrInvalidState):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_STATE"
+		msg = "unknown review state"
+
+	case errors.Is(err, service.ErrInvalidSettings):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_SETTINGS"
+		msg = "invalid team settings"
+
+	case errors.Is(err, service.ErrInvalidPR):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_PR"
+		msg = "invalid pull request fields"
+
+	case errors.Is(err, service.ErrVersionConflict):
+		statusCode = http.StatusConflict
+		appCode = "VERSION_CONFLICT"
+		msg = "pull request was modified concurrently"
+
+	case errors.Is(err, service.ErrNotApproved):
+		statusCode = http.StatusConflict
+		appCode = "NOT_APPROVED"
+		msg = "pull request lacks approvals of the current head commit"
+
+	case errors.Is(err, service.ErrUndoExpired):
+		statusCode = http.StatusConflict
+		appCode = "UNDO_EXPIRED"
+		msg = "reassignment can no longer be undone"
+
+	case errors.Is(err, service.ErrUndoUnavailable):
+		statusCode = http.StatusConflict
+		appCode = "UNDO_UNAVAILABLE"
+		msg = "no reassignment to undo"
+
+	case errors.Is(err, service.ErrInvalidFilter):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_FILTER"
+		msg = "invalid filter, sort order or cursor"
+
+	case errors.Is(err, service.ErrDeclineLimit):
+		statusCode = http.StatusTooManyRequests
+		appCode = "DECLINE_LIMIT"
+		msg = "daily decline limit reached"
+
+	case errors.Is(err, service.ErrReviewerFound):
+		statusCode = http.StatusConflict
+		appCode = "REVIEWER_ASSIGNED"
+		msg = "user is already a reviewer of this PR"
+
+	case errors.Is(err, service.ErrNotPooled):
+		statusCode = http.StatusConflict
+		appCode = "NOT_IN_POOL"
+		msg = "pull request is not waiting in the pool"
+
+	case errors.Is(err, service.ErrInvalidOrg):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_ORG_FILE"
+		msg = err.Error()
+
+	case errors.Is(err, service.ErrGitHubImport):
+		statusCode = http.StatusBadGateway
+		appCode = "GITHUB_ERROR"
+		msg = err.Error()
+
+	case errors.Is(err, service.ErrGitHubDisabled):
+		statusCode = http.StatusServiceUnavailable
+		appCode = "GITHUB_DISABLED"
+		msg = "github import is not configured"
+
+	case errors.Is(err, service.ErrUserDeparted):
+		statusCode = http.StatusConflict
+		appCode = "USER_DEPARTED"
+		msg = err.Error()
+
+	case errors.Is(err, service.ErrInvalidUser):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_USER"
+		msg = err.Error()
+
+	case errors.Is(err, service.ErrInvalidUserRole):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_USER_ROLE"
+		msg = "unknown user role"
+
+	case errors.Is(err, service.ErrInvalidRole):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_ROLE"
+		msg = "unknown reviewer role"
+
+	case errors.Is(err, service.ErrInvalidTeam):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_TEAM"
+		msg = "invalid team name, members or review policy"
+
+	case errors.Is(err, service.ErrTeamArchived):
+		statusCode = http.StatusConflict
+		appCode = "TEAM_ARCHIVED"
+		msg = "team is archived"
+
+	case errors.Is(err, service.ErrTeamInUse):
+		statusCode = http.StatusConflict
+		appCode = "TEAM_IN_USE"
+		msg = "team still has members or open pull requests"
+
+	case errors.Is(err, service.ErrNotMember):
+		statusCode = http.StatusConflict
+		appCode = "NOT_MEMBER"
+		msg = err.Error()
+
+	case errors.Is(err, service.ErrInvalidOperation):
+		statusCode = http.StatusBadRequest
+		appCode = "INVALID_OPERATION"
+		msg = "invalid bulk operation"
+
+	case errors.Is(err, service.ErrRolledBack):
+		statusCode = http.StatusConflict
+		appCode = "ROLLED_BACK"
+		msg = "rolled back because another operation failed"
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+	return statusCode, appCode, msg
+}
+
+
+func (h *Handler) respondError(w http.ResponseWriter, err error) {
+	statusCode, appCode, msg := errorInfo(err)
+
+	payload := map[string]interface{}{
 		"error": map[string]string{
 			"code":    appCode,
 			"message": msg,
 		},
-	})
+	}
+
+	var conflict *service.VersionConflictError
+	if errors.As(err, &conflict) {
+		payload["current_version"] = conflict.Current
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(payload)
 }
 
 
@@ -91,23 +243,33 @@ func (h *Handler) CreateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req entity.Team
+	var req struct {
+		entity.Team
+		MoveMembers bool `json:"move_members"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.svc.CreateTeam(r.Context(), req); err != nil {
+	if err := h.svc.CreateTeam(r.Context(), req.Team, req.MoveMembers); err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	// Members may have kept their stored roles and weights.
+	team, err := h.svc.GetTeam(r.Context(), req.Name)
+	if err != nil {
 		h.respondError(w, err)
 		return
 	}
 
 	h.respondJSON(w, http.StatusCreated, map[string]interface{}{
-		"team": req,
+		"team": team,
 	})
 }
 
-// GET /team/get?team_name=...
+// GET /team/get?team_name=...&subtree=true
 func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -120,7 +282,13 @@ func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	team, err := h.svc.GetTeam(r.Context(), name)
+	var team *entity.Team
+	var err error
+	if r.URL.Query().Get("subtree") == "true" {
+		team, err = h.svc.GetTeamTree(r.Context(), name)
+	} else {
+		team, err = h.svc.GetTeam(r.Context(), name)
+	}
 	if err != nil {
 		h.respondError(w, err)
 		return
@@ -129,151 +297,1225 @@ func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, team)
 }
 
-// -------------------------------------------------------------------
-// USERS
-// -------------------------------------------------------------------
+// POST /team/settings
+func (h *Handler) UpdateTeamSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-// POST /users/setIsActive
-func (h *Handler) SetUserActive(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TeamName string          `json:"team_name"`
+		Settings json.RawMessage `json:"settings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	team, err := h.svc.GetTeam(r.Context(), req.TeamName)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	// Fields missing from the request keep their current values.
+	settings := team.TeamSettings
+	if len(req.Settings) > 0 {
+		if err := json.Unmarshal(req.Settings, &settings); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+
+	team, err = h.svc.UpdateTeamSettings(r.Context(), req.TeamName, settings)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"team": team,
+	})
+}
+
+// POST /team/repositorySettings
+func (h *Handler) SaveRepositorySettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req entity.RepositorySettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	team, err := h.svc.SaveRepositorySettings(r.Context(), req)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"team": team,
+	})
+}
+
+// POST /team/addMembers
+func (h *Handler) AddTeamMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TeamName    string              `json:"team_name"`
+		Members     []entity.TeamMember `json:"members"`
+		MoveMembers bool                `json:"move_members"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	team, err := h.svc.AddTeamMembers(r.Context(), req.TeamName, req.Members, req.MoveMembers)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"team": team,
+	})
+}
+
+// POST /team/updateMember
+func (h *Handler) UpdateTeamMember(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
+		TeamName string `json:"team_name"`
 		UserID   string `json:"user_id"`
-		IsActive bool   `json:"is_active"`
+		TeamRole string `json:"team_role"`
+		Weight   int    `json:"weight"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.svc.SetUserActive(r.Context(), req.UserID, req.IsActive); err != nil {
+	team, err := h.svc.UpdateMember(r.Context(), entity.TeamMember{
+		User:     entity.User{ID: req.UserID, TeamName: req.TeamName},
+		TeamRole: req.TeamRole,
+		Weight:   req.Weight,
+	})
+	if err != nil {
 		h.respondError(w, err)
 		return
 	}
 
-	user, err := h.svc.GetUser(r.Context(), req.UserID)
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"team": team,
+	})
+}
+
+// POST /team/removeMember
+func (h *Handler) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TeamName     string `json:"team_name"`
+		UserID       string `json:"user_id"`
+		ReviewPolicy string `json:"review_policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	reassigned, skipped, err := h.svc.RemoveTeamMember(r.Context(), req.TeamName, req.UserID, req.ReviewPolicy)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	team, err := h.svc.GetTeam(r.Context(), req.TeamName)
 	if err != nil {
 		h.respondError(w, err)
+		return
 	}
+
 	h.respondJSON(w, http.StatusOK, map[string]interface{}{
-		"user": user,
+		"team":           team,
+		"reassigned":     reassigned,
+		"not_reassigned": skipped,
 	})
 }
 
-// GET /users/getReview?user_id=...
-func (h *Handler) GetUserReviews(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// POST /team/rename
+func (h *Handler) RenameTeam(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "missing user_id", http.StatusBadRequest)
+	var req struct {
+		TeamName string `json:"team_name"`
+		NewName  string `json:"new_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	prs, err := h.svc.GetUserReviews(r.Context(), userID)
+	team, err := h.svc.RenameTeam(r.Context(), req.TeamName, req.NewName)
 	if err != nil {
 		h.respondError(w, err)
 		return
 	}
 
-	if prs == nil {
-		prs = []entity.PullRequest{}
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"team": team,
+	})
+}
+
+// POST /team/setParent
+func (h *Handler) SetTeamParent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TeamName   string `json:"team_name"`
+		ParentTeam string `json:"parent_team"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	team, err := h.svc.SetTeamParent(r.Context(), req.TeamName, req.ParentTeam)
+	if err != nil {
+		h.respondError(w, err)
+		return
 	}
 
 	h.respondJSON(w, http.StatusOK, map[string]interface{}{
-		"user_id":       userID,
-		"pull_requests": prs,
+		"team": team,
 	})
 }
 
-// -------------------------------------------------------------------
-// PULL REQUESTS
-// -------------------------------------------------------------------
+// POST /team/archive
+func (h *Handler) ArchiveTeam(w http.ResponseWriter, r *http.Request) {
+	h.setTeamArchived(w, r, true)
+}
 
-// POST /pullRequest/create
-func (h *Handler) CreatePR(w http.ResponseWriter, r *http.Request) {
+// POST /team/unarchive
+func (h *Handler) UnarchiveTeam(w http.ResponseWriter, r *http.Request) {
+	h.setTeamArchived(w, r, false)
+}
+
+func (h *Handler) setTeamArchived(w http.ResponseWriter, r *http.Request, archived bool) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		ID       string `json:"pull_request_id"`
-		Name     string `json:"pull_request_name"`
-		AuthorID string `json:"author_id"`
+		TeamName string `json:"team_name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	pr, err := h.svc.CreatePR(r.Context(), req.ID, req.Name, req.AuthorID)
+	team, err := h.svc.ArchiveTeam(r.Context(), req.TeamName, archived)
 	if err != nil {
 		h.respondError(w, err)
 		return
 	}
 
-	h.respondJSON(w, http.StatusCreated, map[string]interface{}{
-		"pr": pr,
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"team": team,
 	})
 }
 
-// POST /pullRequest/merge
-func (h *Handler) MergePR(w http.ResponseWriter, r *http.Request) {
+// POST /team/delete
+func (h *Handler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		ID string `json:"pull_request_id"`
+		TeamName   string `json:"team_name"`
+		TargetTeam string `json:"target_team"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	pr, err := h.svc.MergePR(r.Context(), req.ID)
+	movedUsers, movedPRs, err := h.svc.DeleteTeam(r.Context(), req.TeamName, req.TargetTeam)
 	if err != nil {
 		h.respondError(w, err)
 		return
 	}
 
 	h.respondJSON(w, http.StatusOK, map[string]interface{}{
-		"pr": pr,
+		"team_name":           req.TeamName,
+		"moved_users":         movedUsers,
+		"moved_pull_requests": movedPRs,
 	})
 }
 
-// POST /pullRequest/reassign
-func (h *Handler) ReassignReviewer(w http.ResponseWriter, r *http.Request) {
+// -------------------------------------------------------------------
+// USERS
+// -------------------------------------------------------------------
+
+// POST /users/setIsActive
+func (h *Handler) SetUserActive(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		PRID      string `json:"pull_request_id"`
-		OldUserID string `json:"old_user_id"`
+		UserID          string `json:"user_id"`
+		IsActive        bool   `json:"is_active"`
+		ReassignReviews bool   `json:"reassign_reviews"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
 
-	pr, newID, err := h.svc.ReassignReviewer(r.Context(), req.PRID, req.OldUserID)
+	reassigned, skipped, err := h.svc.SetUserActive(r.Context(), req.UserID, req.IsActive, req.ReassignReviews)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	user, err := h.svc.GetUser(r.Context(), req.UserID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	payload := map[string]interface{}{
+		"user": user,
+	}
+	if req.ReassignReviews {
+		payload["reassigned"] = reassigned
+		payload["not_reassigned"] = skipped
+	}
+	h.respondJSON(w, http.StatusOK, payload)
+}
+
+// POST /users/offboard
+func (h *Handler) OffboardUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.svc.OffboardUser(r.Context(), req.UserID)
 	if err != nil {
 		h.respondError(w, err)
 		return
 	}
 
 	h.respondJSON(w, http.StatusOK, map[string]interface{}{
-		"pr":          pr,
-		"replaced_by": newID,
+		"user":           res.User,
+		"reassigned":     res.Reassigned,
+		"not_reassigned": res.Skipped,
+		"left_teams":     res.LeftTeams,
 	})
-}
\ No newline at end of file
+}
+
+// POST /users/setRole
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID   string `json:"user_id"`
+		UserRole string `json:"user_role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.svc.SetUserRole(r.Context(), req.UserID, req.UserRole)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user": user,
+	})
+}
+
+// POST /users/setOnboarding
+// Kept for clients predating team roles; same as /team/updateMember with
+// team_role onboarding or member.
+func (h *Handler) SetUserOnboarding(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID       string `json:"user_id"`
+		TeamName     string `json:"team_name"`
+		IsOnboarding bool   `json:"is_onboarding"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.svc.SetUserOnboarding(r.Context(), req.UserID, req.TeamName, req.IsOnboarding)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user": user,
+	})
+}
+
+// POST /users/setGitHubLogin
+func (h *Handler) SetGitHubLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Login  string `json:"login"`
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.SetGitHubLogin(r.Context(), req.Login, req.UserID); err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"login":   req.Login,
+		"user_id": req.UserID,
+	})
+}
+
+// POST /users/transfer
+func (h *Handler) TransferUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		UserID       string `json:"user_id"`
+		TeamName     string `json:"team_name"`
+		FromTeam     string `json:"from_team"`
+		ReviewPolicy string `json:"review_policy"`
+		PRPolicy     string `json:"pr_policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.svc.TransferUser(r.Context(), service.TransferInput{
+		UserID:       req.UserID,
+		TeamName:     req.TeamName,
+		FromTeam:     req.FromTeam,
+		ReviewPolicy: req.ReviewPolicy,
+		PRPolicy:     req.PRPolicy,
+	})
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user":                res.User,
+		"transfer":            res.Transfer,
+		"reassigned":          res.Reassigned,
+		"not_reassigned":      res.Skipped,
+		"moved_pull_requests": res.MovedPRs,
+	})
+}
+
+// GET /users/transfers?user_id=...
+func (h *Handler) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "missing user_id", http.StatusBadRequest)
+		return
+	}
+
+	transfers, err := h.svc.GetTransfers(r.Context(), userID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	if transfers == nil {
+		transfers = []entity.TeamTransfer{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":   userID,
+		"transfers": transfers,
+	})
+}
+
+// GET /users/getReview?user_id=...
+func (h *Handler) GetUserReviews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "missing user_id", http.StatusBadRequest)
+		return
+	}
+
+	prs, err := h.svc.GetUserReviews(r.Context(), userID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	if prs == nil {
+		prs = []entity.UserReview{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":       userID,
+		"pull_requests": prs,
+	})
+}
+
+// GET /users/stats
+func (h *Handler) GetReviewerStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "missing user_id", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.svc.GetReviewerStats(r.Context(), userID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"stats": stats,
+	})
+}
+
+// -------------------------------------------------------------------
+// PULL REQUESTS
+// -------------------------------------------------------------------
+
+// POST /pullRequest/create
+func (h *Handler) CreatePR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID           string   `json:"pull_request_id"`
+		Name         string   `json:"pull_request_name"`
+		AuthorID     string   `json:"author_id"`
+		TeamName     string   `json:"team_name"`
+		Repository   string   `json:"repository"`
+		Number       *int     `json:"number"`
+		SourceBranch string   `json:"source_branch"`
+		TargetBranch string   `json:"target_branch"`
+		URL          string   `json:"url"`
+		Labels       []string `json:"labels"`
+		ParentID     *string  `json:"parent_id"`
+		HeadSHA      string   `json:"head_sha"`
+		Priority     string   `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.CreatePR(r.Context(), entity.PullRequest{
+		ID:           req.ID,
+		Name:         req.Name,
+		AuthorID:     req.AuthorID,
+		TeamName:     req.TeamName,
+		Repository:   req.Repository,
+		Number:       req.Number,
+		SourceBranch: req.SourceBranch,
+		TargetBranch: req.TargetBranch,
+		URL:          req.URL,
+		Labels:       req.Labels,
+		ParentID:     req.ParentID,
+		HeadSHA:      req.HeadSHA,
+		Priority:     req.Priority,
+	})
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// GET /pullRequest/get?pull_request_id=... or ?repository=...&number=...
+func (h *Handler) GetPR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	prID := query.Get("pull_request_id")
+	if prID == "" && query.Get("repository") != "" {
+		number, err := strconv.Atoi(query.Get("number"))
+		if err != nil {
+			http.Error(w, "invalid number", http.StatusBadRequest)
+			return
+		}
+		prID = service.RepositoryPRID(query.Get("repository"), number)
+	}
+	if prID == "" {
+		http.Error(w, "missing pull_request_id", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.GetPR(r.Context(), prID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/update
+func (h *Handler) UpdatePR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID           string   `json:"pull_request_id"`
+		Version      *int     `json:"version"`
+		Name         *string  `json:"pull_request_name"`
+		SourceBranch *string  `json:"source_branch"`
+		TargetBranch *string  `json:"target_branch"`
+		URL          *string  `json:"url"`
+		Labels       []string `json:"labels"`
+		Priority     *string  `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.Version == nil {
+		http.Error(w, "missing version", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.UpdatePR(r.Context(), req.ID, *req.Version, service.PRUpdate{
+		Name:         req.Name,
+		SourceBranch: req.SourceBranch,
+		TargetBranch: req.TargetBranch,
+		URL:          req.URL,
+		Labels:       req.Labels,
+		Priority:     req.Priority,
+	})
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/merge
+func (h *Handler) MergePR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID string `json:"pull_request_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.MergePR(r.Context(), req.ID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/close
+func (h *Handler) ClosePR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID string `json:"pull_request_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.ClosePR(r.Context(), req.ID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/bulk
+func (h *Handler) BulkPR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Atomic     bool                    `json:"atomic"`
+		Operations []service.BulkOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	results, committed, err := h.svc.Bulk(r.Context(), req.Operations, req.Atomic)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(results))
+	for _, res := range results {
+		item := map[string]interface{}{
+			"op":              res.Op,
+			"pull_request_id": res.PRID,
+		}
+		if res.Err != nil {
+			status, code, msg := errorInfo(res.Err)
+			item["status"] = status
+			item["error"] = map[string]string{
+				"code":    code,
+				"message": msg,
+			}
+		} else {
+			item["status"] = http.StatusOK
+			item["pr"] = res.PR
+			if res.ReplacedBy != "" {
+				item["replaced_by"] = res.ReplacedBy
+			}
+		}
+		items = append(items, item)
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"atomic":    req.Atomic,
+		"committed": committed,
+		"results":   items,
+	})
+}
+
+// POST /pullRequest/reassign
+func (h *Handler) ReassignReviewer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PRID      string `json:"pull_request_id"`
+		OldUserID string `json:"old_user_id"`
+		NewUserID string `json:"new_user_id"`
+		Reason    string `json:"reason"`
+		Comment   string `json:"comment"`
+		Propagate bool   `json:"propagate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.svc.ReassignReviewer(r.Context(), service.ReassignInput{
+		PRID:      req.PRID,
+		OldUserID: req.OldUserID,
+		NewUserID: req.NewUserID,
+		Reason:    req.Reason,
+		Comment:   req.Comment,
+		Propagate: req.Propagate,
+	})
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	payload := map[string]interface{}{
+		"pr":          res.PR,
+		"replaced_by": res.ReplacedBy,
+	}
+	if req.Propagate {
+		payload["propagated"] = res.Propagated
+	}
+	h.respondJSON(w, http.StatusOK, payload)
+}
+
+// POST /pullRequest/addReviewer
+func (h *Handler) AddReviewer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PRID   string `json:"pull_request_id"`
+		UserID string `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.AddReviewer(r.Context(), req.PRID, req.UserID, req.Role)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/decline
+func (h *Handler) DeclineReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PRID    string `json:"pull_request_id"`
+		UserID  string `json:"user_id"`
+		Reason  string `json:"reason"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.svc.DeclineReview(r.Context(), req.PRID, req.UserID, req.Reason, req.Comment)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr":          res.PR,
+		"replaced_by": res.ReplacedBy,
+	})
+}
+
+// POST /pullRequest/push
+func (h *Handler) PushCommit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PRID string `json:"pull_request_id"`
+		SHA  string `json:"head_sha"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, reset, err := h.svc.PushCommit(r.Context(), req.PRID, req.SHA)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr":                 pr,
+		"re_review_required": reset,
+	})
+}
+
+// POST /pullRequest/review
+func (h *Handler) SubmitReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PRID   string `json:"pull_request_id"`
+		UserID string `json:"user_id"`
+		State  string `json:"state"`
+		SHA    string `json:"commit_sha"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.SubmitReview(r.Context(), req.PRID, req.UserID, req.State, req.SHA)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// POST /pullRequest/reassign/undo
+func (h *Handler) UndoReassignment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PRID           string `json:"pull_request_id"`
+		ReassignmentID int64  `json:"reassignment_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, undone, err := h.svc.UndoReassignment(r.Context(), req.PRID, req.ReassignmentID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr":       pr,
+		"restored": undone.OldUserID,
+		"removed":  undone.NewUserID,
+	})
+}
+
+// GET /pullRequest/list?status=...&author_id=...&team_name=...&reviewer_id=...
+//     &repository=...&label=...&created_from=...&created_to=...
+//     &sort=created_at|name&order=asc|desc&limit=...&cursor=...
+func (h *Handler) ListPRs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := entity.PRFilter{
+		Status:     q.Get("status"),
+		AuthorID:   q.Get("author_id"),
+		TeamName:   q.Get("team_name"),
+		ReviewerID: q.Get("reviewer_id"),
+		Repository: q.Get("repository"),
+		Label:      q.Get("label"),
+		SortBy:     q.Get("sort"),
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+		filter.Desc = true
+	case "asc":
+	default:
+		http.Error(w, "invalid order", http.StatusBadRequest)
+		return
+	}
+
+	for param, dst := range map[string]**time.Time{
+		"created_from": &filter.CreatedFrom,
+		"created_to":   &filter.CreatedTo,
+	} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid "+param, http.StatusBadRequest)
+			return
+		}
+		*dst = &t
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	prs, next, err := h.svc.ListPRs(r.Context(), filter, q.Get("cursor"))
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	if prs == nil {
+		prs = []entity.PullRequest{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pull_requests": prs,
+		"next_cursor":   next,
+	})
+}
+
+// GET /pullRequest/stack?pull_request_id=...
+func (h *Handler) GetStack(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prID := r.URL.Query().Get("pull_request_id")
+	if prID == "" {
+		http.Error(w, "missing pull_request_id", http.StatusBadRequest)
+		return
+	}
+
+	stack, err := h.svc.GetStack(r.Context(), prID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pull_request_id": prID,
+		"stack":           stack,
+	})
+}
+
+// GET /pullRequest/history?pull_request_id=...
+func (h *Handler) GetReassignments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prID := r.URL.Query().Get("pull_request_id")
+	if prID == "" {
+		http.Error(w, "missing pull_request_id", http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.svc.GetReassignments(r.Context(), prID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	if history == nil {
+		history = []entity.Reassignment{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pull_request_id": prID,
+		"reassignments":   history,
+	})
+}
+
+// -------------------------------------------------------------------
+// POOL
+// -------------------------------------------------------------------
+
+// GET /pool/list
+func (h *Handler) ListPool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	teamName := r.URL.Query().Get("team_name")
+	if teamName == "" {
+		http.Error(w, "missing team_name", http.StatusBadRequest)
+		return
+	}
+
+	prs, err := h.svc.ListPool(r.Context(), teamName)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	if prs == nil {
+		prs = []entity.PullRequest{}
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"team_name":     teamName,
+		"pull_requests": prs,
+	})
+}
+
+// POST /pool/claim
+func (h *Handler) ClaimPR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		PRID   string `json:"pull_request_id"`
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	pr, err := h.svc.ClaimPR(r.Context(), req.PRID, req.UserID)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"pr": pr,
+	})
+}
+
+// -------------------------------------------------------------------
+// ORG SYNC
+// -------------------------------------------------------------------
+
+// POST /org/sync?apply=true&prune=true
+// The body is the org file in CSV. Without apply only the plan is returned.
+func (h *Handler) SyncOrg(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spec, err := service.ParseOrgCSV(r.Body)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	q := r.URL.Query()
+	res, err := h.svc.SyncOrg(r.Context(), spec, q.Get("apply") == "true", q.Get("prune") == "true")
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"plan":    res.Plan,
+		"applied": res.Applied,
+	})
+}
+
+// POST /org/importGitHub
+func (h *Handler) ImportGitHubOrg(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Org string `json:"org"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Org == "" {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.svc.ImportGitHubOrg(r.Context(), req.Org)
+	if err != nil {
+		h.respondError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,1134 @@
+package handler
+
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/service"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+
+// SCIM 2.0 (RFC 7643, RFC 7644) on top of users and teams. A SCIM user's id
+// is the user ID, which never changes; userName and displayName are both the
+// username, with userName taking precedence on writes. A group's id and
+// displayName are the team name, so groups cannot be renamed. An eq filter on
+// the name is looked up in storage; the rest of the filter is evaluated in
+// memory.
+
+
+const (
+	scimUserSchema	= "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema	= "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema	= "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema	= "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	scimUsersPath	= "/scim/v2/Users"
+	scimGroupsPath	= "/scim/v2/Groups"
+
+	scimDefaultCount	= 100
+)
+
+
+type scimMeta struct {
+	ResourceType	string 		`json:"resourceType"`
+	Location		string 		`json:"location"`
+}
+
+
+type scimRef struct {
+	Value		string 		`json:"value"`
+	Display		string 		`json:"display,omitempty"`
+}
+
+
+type scimUser struct {
+	Schemas			[]string 	`json:"schemas"`
+	ID				string 		`json:"id"`
+	UserName		string 		`json:"userName"`
+	DisplayName		string 		`json:"displayName"`
+	Active			bool 		`json:"active"`
+	Groups			[]scimRef 	`json:"groups"`
+	Meta			scimMeta 	`json:"meta"`
+}
+
+
+type scimGroup struct {
+	Schemas			[]string 	`json:"schemas"`
+	ID				string 		`json:"id"`
+	DisplayName		string 		`json:"displayName"`
+	Members			[]scimRef 	`json:"members"`
+	Meta			scimMeta 	`json:"meta"`
+}
+
+
+type scimPatchOp struct {
+	Op		string 				`json:"op"`
+	Path	string 				`json:"path"`
+	Value	json.RawMessage 	`json:"value"`
+}
+
+
+type scimPatchRequest struct {
+	Operations	[]scimPatchOp 	`json:"Operations"`
+}
+
+
+// scimError is a client error reported with a SCIM scimType.
+type scimError struct {
+	status		int
+	scimType	string
+	detail		string
+}
+
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+
+func scimInvalid(scimType, format string, args ...interface{}) error {
+	return &scimError{status: http.StatusBadRequest, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+
+func (h *Handler) respondSCIM(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	if payload != nil {
+		if err := json.NewEncoder(w).Encode(payload); err != nil {
+			log.Printf("error writing response: %v", err)
+		}
+	}
+}
+
+
+func (h *Handler) respondSCIMError(w http.ResponseWriter, err error) {
+	var scimErr *scimError
+	if !errors.As(err, &scimErr) {
+		status, _, msg := errorInfo(err)
+		scimErr = &scimError{status: status, detail: msg}
+		switch {
+		case errors.Is(err, storage.ErrAlreadyExists):
+			scimErr.scimType = "uniqueness"
+		case status == http.StatusBadRequest:
+			scimErr.scimType = "invalidValue"
+		}
+	}
+
+	payload := map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(scimErr.status),
+		"detail":  scimErr.detail,
+	}
+	if scimErr.scimType != "" {
+		payload["scimType"] = scimErr.scimType
+	}
+	h.respondSCIM(w, scimErr.status, payload)
+}
+
+
+// decodeSCIM reads a JSON request body into v.
+func decodeSCIM(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return scimInvalid("invalidSyntax", "invalid json")
+	}
+	return nil
+}
+
+
+// scimResourceID returns the part of the path after the collection, "" for
+// the collection itself.
+func scimResourceID(r *http.Request, collection string) string {
+	id := strings.TrimPrefix(r.URL.Path, collection)
+	return strings.TrimPrefix(id, "/")
+}
+
+// -------------------------------------------------------------------
+// USERS
+// -------------------------------------------------------------------
+
+// GET|POST /scim/v2/Users
+// GET|PUT|PATCH|DELETE /scim/v2/Users/{id}
+func (h *Handler) SCIMUsers(w http.ResponseWriter, r *http.Request) {
+	id := scimResourceID(r, scimUsersPath)
+
+	var err error
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		err = h.listSCIMUsers(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		err = h.createSCIMUser(w, r)
+	case id != "" && r.Method == http.MethodGet:
+		err = h.getSCIMUser(w, r, id)
+	case id != "" && r.Method == http.MethodPut:
+		err = h.replaceSCIMUser(w, r, id)
+	case id != "" && r.Method == http.MethodPatch:
+		err = h.patchSCIMUser(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		err = h.deleteSCIMUser(w, r, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		h.respondSCIMError(w, err)
+	}
+}
+
+
+func (h *Handler) listSCIMUsers(w http.ResponseWriter, r *http.Request) error {
+	filter, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		return err
+	}
+
+	var users []entity.User
+	if name, ok := scimEqValue(filter, "username", "displayname"); ok {
+		users, err = h.svc.FindUsersByUsername(r.Context(), name)
+	} else {
+		users, err = h.svc.ListUsers(r.Context())
+	}
+	if err != nil {
+		return err
+	}
+
+	resources := make([]interface{}, 0)
+	for _, u := range users {
+		if filter == nil || filter.match(scimUserAttrs(u)) {
+			resources = append(resources, toSCIMUser(u))
+		}
+	}
+	return h.respondSCIMList(w, r, resources)
+}
+
+
+func (h *Handler) getSCIMUser(w http.ResponseWriter, r *http.Request, id string) error {
+	user, err := h.svc.GetUser(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	h.respondSCIM(w, http.StatusOK, toSCIMUser(*user))
+	return nil
+}
+
+
+// POST takes the user ID from externalId, or from userName when it is absent.
+func (h *Handler) createSCIMUser(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		ExternalID		string 		`json:"externalId"`
+		UserName		string 		`json:"userName"`
+		DisplayName		string 		`json:"displayName"`
+		Active			interface{} `json:"active"`
+	}
+	if err := decodeSCIM(r, &req); err != nil {
+		return err
+	}
+
+	active := true
+	if req.Active != nil {
+		var err error
+		if active, err = scimBool(req.Active); err != nil {
+			return err
+		}
+	}
+
+	id := req.ExternalID
+	if id == "" {
+		id = req.UserName
+	}
+	username := req.UserName
+	if username == "" {
+		username = req.DisplayName
+	}
+
+	user, err := h.svc.CreateUser(r.Context(), entity.User{
+		ID:       id,
+		Username: username,
+		IsActive: active,
+	})
+	if err != nil {
+		return err
+	}
+
+	h.respondSCIM(w, http.StatusCreated, toSCIMUser(*user))
+	return nil
+}
+
+
+// PUT replaces userName and active.
+func (h *Handler) replaceSCIMUser(w http.ResponseWriter, r *http.Request, id string) error {
+	var req struct {
+		UserName		string 		`json:"userName"`
+		DisplayName		string 		`json:"displayName"`
+		Active			interface{} `json:"active"`
+	}
+	if err := decodeSCIM(r, &req); err != nil {
+		return err
+	}
+
+	change := scimUserChange{}
+	if req.UserName != "" {
+		change.userName = &req.UserName
+	}
+	if req.DisplayName != "" {
+		change.displayName = &req.DisplayName
+	}
+	if req.Active != nil {
+		active, err := scimBool(req.Active)
+		if err != nil {
+			return err
+		}
+		change.active = &active
+	}
+
+	return h.applySCIMUserChange(w, r, id, change)
+}
+
+
+func (h *Handler) patchSCIMUser(w http.ResponseWriter, r *http.Request, id string) error {
+	var req scimPatchRequest
+	if err := decodeSCIM(r, &req); err != nil {
+		return err
+	}
+
+	change := scimUserChange{}
+	for _, op := range req.Operations {
+		kind := strings.ToLower(op.Op)
+		if kind != "add" && kind != "replace" && kind != "remove" {
+			return scimInvalid("invalidSyntax", "unknown patch op %q", op.Op)
+		}
+
+		values := map[string]json.RawMessage{}
+		if op.Path == "" {
+			if kind == "remove" {
+				return scimInvalid("noTarget", "remove requires a path")
+			}
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return scimInvalid("invalidValue", "patch value must be an object")
+			}
+		} else {
+			values[op.Path] = op.Value
+		}
+
+		for path, raw := range values {
+			if kind == "remove" {
+				return scimInvalid("mutability", "attribute %q cannot be removed", path)
+			}
+			if err := change.set(path, raw); err != nil {
+				return err
+			}
+		}
+	}
+
+	return h.applySCIMUserChange(w, r, id, change)
+}
+
+
+// DELETE deprovisions the user the same way as /users/setIsActive with
+// reassign_reviews; the user itself is kept.
+func (h *Handler) deleteSCIMUser(w http.ResponseWriter, r *http.Request, id string) error {
+	if _, _, err := h.svc.SetUserActive(r.Context(), id, false, true); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+
+// scimUserChange collects the attributes a PUT or PATCH sets.
+type scimUserChange struct {
+	userName		*string
+	displayName		*string
+	active			*bool
+}
+
+
+// username returns the new username: userName if set, else displayName.
+func (c *scimUserChange) username() *string {
+	if c.userName != nil {
+		return c.userName
+	}
+	return c.displayName
+}
+
+
+func (c *scimUserChange) set(path string, raw json.RawMessage) error {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return scimInvalid("invalidValue", "invalid value for %q", path)
+	}
+
+	switch scimAttrName(path, scimUserSchema) {
+	case "active":
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		c.active = &active
+
+	case "displayname":
+		name, ok := value.(string)
+		if !ok || name == "" {
+			return scimInvalid("invalidValue", "displayName must be a non-empty string")
+		}
+		c.displayName = &name
+
+	case "username":
+		name, ok := value.(string)
+		if !ok || name == "" {
+			return scimInvalid("invalidValue", "userName must be a non-empty string")
+		}
+		c.userName = &name
+
+	default:
+		return scimInvalid("invalidPath", "unsupported attribute %q", path)
+	}
+	return nil
+}
+
+
+// applySCIMUserChange saves the change and responds with the user.
+// Deactivation hands the user's open reviews to others.
+func (h *Handler) applySCIMUserChange(w http.ResponseWriter, r *http.Request, id string, change scimUserChange) error {
+	user, err := h.svc.UpdateUser(r.Context(), id, service.UserChange{
+		Username: change.username(),
+		IsActive: change.active,
+	})
+	if err != nil {
+		return err
+	}
+
+	h.respondSCIM(w, http.StatusOK, toSCIMUser(*user))
+	return nil
+}
+
+
+func toSCIMUser(u entity.User) scimUser {
+	groups := make([]scimRef, 0, len(u.Teams))
+	for _, team := range u.Teams {
+		groups = append(groups, scimRef{Value: team, Display: team})
+	}
+
+	return scimUser{
+		Schemas:     []string{scimUserSchema},
+		ID:          u.ID,
+		UserName:    u.Username,
+		DisplayName: u.Username,
+		Active:      u.IsActive,
+		Groups:      groups,
+		Meta: scimMeta{
+			ResourceType: "User",
+			Location:     scimUsersPath + "/" + url.PathEscape(u.ID),
+		},
+	}
+}
+
+
+func scimUserAttrs(u entity.User) map[string][]string {
+	return map[string][]string{
+		"id":           {u.ID},
+		"username":     {u.Username},
+		"displayname":  {u.Username},
+		"active":       {strconv.FormatBool(u.IsActive)},
+		"groups":       u.Teams,
+		"groups.value": u.Teams,
+	}
+}
+
+// -------------------------------------------------------------------
+// GROUPS
+// -------------------------------------------------------------------
+
+// GET|POST /scim/v2/Groups
+// GET|PUT|PATCH|DELETE /scim/v2/Groups/{id}
+func (h *Handler) SCIMGroups(w http.ResponseWriter, r *http.Request) {
+	id := scimResourceID(r, scimGroupsPath)
+
+	var err error
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		err = h.listSCIMGroups(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		err = h.createSCIMGroup(w, r)
+	case id != "" && r.Method == http.MethodGet:
+		err = h.getSCIMGroup(w, r, id)
+	case id != "" && r.Method == http.MethodPut:
+		err = h.replaceSCIMGroup(w, r, id)
+	case id != "" && r.Method == http.MethodPatch:
+		err = h.patchSCIMGroup(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		err = h.deleteSCIMGroup(w, r, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		h.respondSCIMError(w, err)
+	}
+}
+
+
+func (h *Handler) listSCIMGroups(w http.ResponseWriter, r *http.Request) error {
+	filter, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		return err
+	}
+
+	var teams []entity.Team
+	if name, ok := scimEqValue(filter, "id", "displayname"); ok {
+		teams, err = h.svc.FindTeams(r.Context(), name)
+	} else {
+		teams, err = h.svc.ListTeams(r.Context())
+	}
+	if err != nil {
+		return err
+	}
+
+	resources := make([]interface{}, 0)
+	for _, t := range teams {
+		if filter == nil || filter.match(scimGroupAttrs(t)) {
+			resources = append(resources, toSCIMGroup(t))
+		}
+	}
+	return h.respondSCIMList(w, r, resources)
+}
+
+
+func (h *Handler) getSCIMGroup(w http.ResponseWriter, r *http.Request, id string) error {
+	team, err := h.svc.GetTeam(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	h.respondSCIM(w, http.StatusOK, toSCIMGroup(*team))
+	return nil
+}
+
+
+func (h *Handler) createSCIMGroup(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		DisplayName		string 		`json:"displayName"`
+		Members			[]scimRef 	`json:"members"`
+	}
+	if err := decodeSCIM(r, &req); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(req.Members))
+	seen := make(map[string]bool, len(req.Members))
+	for _, m := range req.Members {
+		if !seen[m.Value] {
+			seen[m.Value] = true
+			ids = append(ids, m.Value)
+		}
+	}
+
+	team, err := h.svc.CreateTeamWithUsers(r.Context(), req.DisplayName, ids)
+	if err != nil {
+		return err
+	}
+
+	h.respondSCIM(w, http.StatusCreated, toSCIMGroup(*team))
+	return nil
+}
+
+
+// PUT replaces the members of the team.
+func (h *Handler) replaceSCIMGroup(w http.ResponseWriter, r *http.Request, id string) error {
+	var req struct {
+		DisplayName		string 		`json:"displayName"`
+		Members			[]scimRef 	`json:"members"`
+	}
+	if err := decodeSCIM(r, &req); err != nil {
+		return err
+	}
+
+	team, err := h.svc.GetTeam(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if req.DisplayName != "" && req.DisplayName != team.Name {
+		return errSCIMGroupRename
+	}
+
+	change := newSCIMGroupChange(team)
+	change.members = map[string]bool{}
+	for _, m := range req.Members {
+		change.members[m.Value] = true
+	}
+
+	return h.applySCIMGroupChange(w, r, team, change)
+}
+
+
+func (h *Handler) patchSCIMGroup(w http.ResponseWriter, r *http.Request, id string) error {
+	var req scimPatchRequest
+	if err := decodeSCIM(r, &req); err != nil {
+		return err
+	}
+
+	team, err := h.svc.GetTeam(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	change := newSCIMGroupChange(team)
+	for _, op := range req.Operations {
+		if err := change.apply(op); err != nil {
+			return err
+		}
+	}
+
+	return h.applySCIMGroupChange(w, r, team, change)
+}
+
+
+// DELETE disbands the team; its former members are kept.
+func (h *Handler) deleteSCIMGroup(w http.ResponseWriter, r *http.Request, id string) error {
+	if err := h.svc.DisbandTeam(r.Context(), id); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+
+// errSCIMGroupRename rejects renames: the team name is the group id, which
+// must not change (RFC 7643, section 3.1).
+var errSCIMGroupRename = scimInvalid("mutability", "displayName is the group id and cannot be changed")
+
+
+// scimGroupChange is the desired member set of a team, built up by applying
+// PUT or PATCH operations to its current state.
+type scimGroupChange struct {
+	name		string
+	members		map[string]bool
+	displays	map[string]string
+}
+
+
+func newSCIMGroupChange(team *entity.Team) *scimGroupChange {
+	c := &scimGroupChange{
+		name:     team.Name,
+		members:  make(map[string]bool, len(team.Members)),
+		displays: make(map[string]string, len(team.Members)),
+	}
+	for _, m := range team.Members {
+		c.members[m.ID] = true
+		c.displays[m.ID] = m.Username
+	}
+	return c
+}
+
+
+func (c *scimGroupChange) apply(op scimPatchOp) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return scimInvalid("invalidSyntax", "unknown patch op %q", op.Op)
+	}
+
+	if op.Path == "" {
+		if kind == "remove" {
+			return scimInvalid("noTarget", "remove requires a path")
+		}
+		values := map[string]json.RawMessage{}
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return scimInvalid("invalidValue", "patch value must be an object")
+		}
+		for path, raw := range values {
+			if err := c.set(kind, path, raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// members[value eq "..."] selects members with a filter.
+	if open := strings.Index(op.Path, "["); open >= 0 && strings.HasSuffix(op.Path, "]") {
+		if scimAttrName(op.Path[:open], scimGroupSchema) != "members" || kind != "remove" {
+			return scimInvalid("invalidPath", "unsupported path %q", op.Path)
+		}
+		filter, err := parseSCIMFilter(op.Path[open+1 : len(op.Path)-1])
+		if err != nil {
+			return err
+		}
+		for id := range c.members {
+			ref := map[string][]string{"value": {id}, "display": {c.displays[id]}}
+			if filter.match(ref) {
+				delete(c.members, id)
+			}
+		}
+		return nil
+	}
+
+	return c.set(kind, op.Path, op.Value)
+}
+
+
+func (c *scimGroupChange) set(kind, path string, raw json.RawMessage) error {
+	switch scimAttrName(path, scimGroupSchema) {
+	case "displayname":
+		if kind == "remove" {
+			return scimInvalid("mutability", "displayName cannot be removed")
+		}
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil || name == "" {
+			return scimInvalid("invalidValue", "displayName must be a non-empty string")
+		}
+		if name != c.name {
+			return errSCIMGroupRename
+		}
+
+	case "members":
+		var refs []scimRef
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &refs); err != nil {
+				return scimInvalid("invalidValue", "members must be a list of references")
+			}
+		}
+
+		switch {
+		case kind == "replace":
+			c.members = map[string]bool{}
+			fallthrough
+		case kind == "add":
+			for _, ref := range refs {
+				c.members[ref.Value] = true
+			}
+		case len(refs) == 0:
+			c.members = map[string]bool{}
+		default:
+			for _, ref := range refs {
+				delete(c.members, ref.Value)
+			}
+		}
+
+	default:
+		return scimInvalid("invalidPath", "unsupported attribute %q", path)
+	}
+	return nil
+}
+
+
+// applySCIMGroupChange adds and removes members in one transaction to reach
+// the desired set and responds with the group.
+func (h *Handler) applySCIMGroupChange(w http.ResponseWriter, r *http.Request, team *entity.Team, change *scimGroupChange) error {
+	add := make([]string, 0)
+	remove := make([]string, 0)
+	for id := range change.members {
+		if _, ok := change.displays[id]; !ok {
+			add = append(add, id)
+		}
+	}
+	for id := range change.displays {
+		if !change.members[id] {
+			remove = append(remove, id)
+		}
+	}
+	sort.Strings(add)
+	sort.Strings(remove)
+
+	updated, err := h.svc.ChangeTeamMembers(r.Context(), team.Name, add, remove)
+	if err != nil {
+		return err
+	}
+
+	h.respondSCIM(w, http.StatusOK, toSCIMGroup(*updated))
+	return nil
+}
+
+
+func toSCIMGroup(t entity.Team) scimGroup {
+	members := make([]scimRef, 0, len(t.Members))
+	for _, m := range t.Members {
+		members = append(members, scimRef{Value: m.ID, Display: m.Username})
+	}
+
+	return scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          t.Name,
+		DisplayName: t.Name,
+		Members:     members,
+		Meta: scimMeta{
+			ResourceType: "Group",
+			Location:     scimGroupsPath + "/" + url.PathEscape(t.Name),
+		},
+	}
+}
+
+
+func scimGroupAttrs(t entity.Team) map[string][]string {
+	ids := make([]string, 0, len(t.Members))
+	for _, m := range t.Members {
+		ids = append(ids, m.ID)
+	}
+
+	return map[string][]string{
+		"id":            {t.Name},
+		"displayname":   {t.Name},
+		"members":       ids,
+		"members.value": ids,
+	}
+}
+
+// -------------------------------------------------------------------
+// LISTING AND FILTERS
+// -------------------------------------------------------------------
+
+// respondSCIMList responds with one page of resources. startIndex is 1-based.
+func (h *Handler) respondSCIMList(w http.ResponseWriter, r *http.Request, resources []interface{}) error {
+	q := r.URL.Query()
+
+	start := 1
+	if v := q.Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return scimInvalid("invalidValue", "invalid startIndex")
+		}
+		if n > 1 {
+			start = n
+		}
+	}
+
+	count := scimDefaultCount
+	if v := q.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return scimInvalid("invalidValue", "invalid count")
+		}
+		count = max(n, 0)
+	}
+
+	total := len(resources)
+	from := min(start-1, total)
+	to := min(from+count, total)
+	page := resources[from:to]
+
+	h.respondSCIM(w, http.StatusOK, map[string]interface{}{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   start,
+		"itemsPerPage": len(page),
+		"Resources":    page,
+	})
+	return nil
+}
+
+
+// scimAttrName lowercases an attribute path and drops the schema prefix.
+func scimAttrName(path, schema string) string {
+	name := strings.ToLower(path)
+	return strings.TrimPrefix(name, strings.ToLower(schema)+":")
+}
+
+
+// scimBool accepts JSON booleans as well as "true" and "false" strings,
+// which some identity providers send.
+func scimBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		if parsed, err := strconv.ParseBool(strings.ToLower(b)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, scimInvalid("invalidValue", "active must be a boolean")
+}
+
+
+// scimFilter is a parsed SCIM filter matched against resource attributes,
+// keyed by lowercased name with multi-valued attributes as several values.
+type scimFilter interface {
+	match(attrs map[string][]string) bool
+}
+
+
+type scimCompare struct {
+	attr	string
+	op		string
+	value	string
+}
+
+
+func (f scimCompare) match(attrs map[string][]string) bool {
+	values := attrs[f.attr]
+	if f.op == "pr" {
+		for _, v := range values {
+			if v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if f.op == "ne" {
+		return !scimCompare{attr: f.attr, op: "eq", value: f.value}.match(attrs)
+	}
+
+	want := strings.ToLower(f.value)
+	for _, v := range values {
+		v = strings.ToLower(v)
+		var ok bool
+		switch f.op {
+		case "eq":
+			ok = v == want
+		case "co":
+			ok = strings.Contains(v, want)
+		case "sw":
+			ok = strings.HasPrefix(v, want)
+		case "ew":
+			ok = strings.HasSuffix(v, want)
+		case "gt":
+			ok = v > want
+		case "ge":
+			ok = v >= want
+		case "lt":
+			ok = v < want
+		case "le":
+			ok = v <= want
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+
+// scimEqValue returns the value an eq comparison on one of attrs requires of
+// every match of f, looking into and-branches.
+func scimEqValue(f scimFilter, attrs ...string) (string, bool) {
+	switch f := f.(type) {
+	case scimCompare:
+		if f.op != "eq" {
+			return "", false
+		}
+		for _, attr := range attrs {
+			if f.attr == attr {
+				return f.value, true
+			}
+		}
+	case scimLogical:
+		if !f.and {
+			return "", false
+		}
+		if v, ok := scimEqValue(f.left, attrs...); ok {
+			return v, true
+		}
+		return scimEqValue(f.right, attrs...)
+	}
+	return "", false
+}
+
+
+type scimLogical struct {
+	and			bool
+	left		scimFilter
+	right		scimFilter
+}
+
+
+func (f scimLogical) match(attrs map[string][]string) bool {
+	if f.and {
+		return f.left.match(attrs) && f.right.match(attrs)
+	}
+	return f.left.match(attrs) || f.right.match(attrs)
+}
+
+
+type scimNot struct {
+	inner	scimFilter
+}
+
+
+func (f scimNot) match(attrs map[string][]string) bool {
+	return !f.inner.match(attrs)
+}
+
+
+// parseSCIMFilter parses a filter expression; an empty one yields nil.
+func parseSCIMFilter(s string) (scimFilter, error) {
+	tokens, err := scimTokens(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, scimInvalid("invalidFilter", "unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+
+type scimToken struct {
+	text	string
+	quoted	bool
+}
+
+
+func scimTokens(s string) ([]scimToken, error) {
+	var tokens []scimToken
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+
+		case c == '(' || c == ')':
+			tokens = append(tokens, scimToken{text: string(c)})
+			i++
+
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, scimInvalid("invalidFilter", "unterminated string in filter")
+			}
+			tokens = append(tokens, scimToken{text: b.String(), quoted: true})
+			i = j + 1
+
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t()\"", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, scimToken{text: s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+
+// scimFilterParser is a recursive descent parser; "and" binds tighter than
+// "or".
+type scimFilterParser struct {
+	tokens	[]scimToken
+	pos		int
+}
+
+
+func (p *scimFilterParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+
+func (p *scimFilterParser) or() (scimFilter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = scimLogical{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+
+func (p *scimFilterParser) and() (scimFilter, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = scimLogical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+
+func (p *scimFilterParser) term() (scimFilter, error) {
+	if p.keyword("not") {
+		if !p.keyword("(") {
+			return nil, scimInvalid("invalidFilter", "expected ( after not")
+		}
+		inner, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		return scimNot{inner: inner}, nil
+	}
+
+	if p.keyword("(") {
+		return p.group()
+	}
+
+	if p.pos+1 >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return nil, scimInvalid("invalidFilter", "expected attribute and operator in filter")
+	}
+	attr := p.tokens[p.pos].text
+	for _, schema := range []string{scimUserSchema, scimGroupSchema} {
+		attr = scimAttrName(attr, schema)
+	}
+	op := strings.ToLower(p.tokens[p.pos+1].text)
+	p.pos += 2
+
+	switch op {
+	case "pr":
+		return scimCompare{attr: attr, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, scimInvalid("invalidFilter", "unknown operator %q in filter", op)
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, scimInvalid("invalidFilter", "missing value in filter")
+	}
+	value := p.tokens[p.pos].text
+	p.pos++
+
+	return scimCompare{attr: attr, op: op, value: value}, nil
+}
+
+
+func (p *scimFilterParser) group() (scimFilter, error) {
+	inner, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.keyword(")") {
+		return nil, scimInvalid("invalidFilter", "missing ) in filter")
+	}
+	return inner, nil
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+func TestParseSCIMFilter(t *testing.T) {
+	alice := map[string][]string{
+		"username":     {"alice"},
+		"displayname":  {"Alice Smith"},
+		"active":       {"true"},
+		"groups.value": {"core", "web"},
+		"title":        {""},
+	}
+
+	cases := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "alice"`, true},
+		{`userName eq "ALICE"`, true},
+		{`userName ne "alice"`, false},
+		{`displayName co "smith"`, true},
+		{`displayName sw "Al"`, true},
+		{`displayName ew "Smith"`, true},
+		{`userName gt "aaa"`, true},
+		{`userName lt "aaa"`, false},
+		{`userName ge "alice" and userName le "alice"`, true},
+		{`userName pr`, true},
+		{`title pr`, false},
+		{`nickName pr`, false},
+		{`groups.value eq "web"`, true},
+		{`groups.value eq "mobile"`, false},
+		{`active eq true and userName eq "bob"`, false},
+		{`userName eq "bob" or active eq true`, true},
+		{`userName eq "bob" or userName eq "carol" and active eq true`, false},
+		{`(userName eq "bob" or userName eq "alice") and active eq true`, true},
+		{`not (userName eq "alice")`, false},
+		{`NOT (userName eq "bob") AND active EQ true`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "alice"`, true},
+		{`displayName eq "Alice \"Al\" Smith"`, false},
+	}
+
+	for _, tc := range cases {
+		f, err := parseSCIMFilter(tc.filter)
+		if err != nil {
+			t.Errorf("%s: %v", tc.filter, err)
+			continue
+		}
+		if got := f.match(alice); got != tc.want {
+			t.Errorf("%s: match = %v, want %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+
+func TestSCIMEqValue(t *testing.T) {
+	cases := []struct {
+		filter string
+		value  string
+		ok     bool
+	}{
+		{`userName eq "alice"`, "alice", true},
+		{`displayName eq "Alice"`, "Alice", true},
+		{`active eq true and userName eq "alice"`, "alice", true},
+		{`userName eq "alice" or userName eq "bob"`, "", false},
+		{`userName sw "al"`, "", false},
+		{`not (userName eq "alice")`, "", false},
+		{`active eq true`, "", false},
+	}
+
+	for _, tc := range cases {
+		f, err := parseSCIMFilter(tc.filter)
+		if err != nil {
+			t.Errorf("%s: %v", tc.filter, err)
+			continue
+		}
+		value, ok := scimEqValue(f, "username", "displayname")
+		if value != tc.value || ok != tc.ok {
+			t.Errorf("%s: scimEqValue = %q, %v, want %q, %v", tc.filter, value, ok, tc.value, tc.ok)
+		}
+	}
+}
+
+
+func TestParseSCIMFilterErrors(t *testing.T) {
+	cases := []string{
+		`userName`,
+		`userName eq`,
+		`userName is "alice"`,
+		`userName eq "alice`,
+		`(userName eq "alice"`,
+		`userName eq "alice")`,
+		`not userName eq "alice"`,
+		`userName eq "alice" and`,
+		`"userName" eq "alice"`,
+	}
+
+	for _, filter := range cases {
+		_, err := parseSCIMFilter(filter)
+
+		var scimErr *scimError
+		if !errors.As(err, &scimErr) || scimErr.scimType != "invalidFilter" {
+			t.Errorf("%s: expected an invalidFilter error, got %v", filter, err)
+		}
+	}
+
+	if f, err := parseSCIMFilter(""); f != nil || err != nil {
+		t.Errorf("empty filter: got %v, %v", f, err)
+	}
+}
+
+
+func TestSCIMGroupChange(t *testing.T) {
+	team := &entity.Team{
+		Name: "core",
+		Members: []entity.TeamMember{
+			{User: entity.User{ID: "u1", Username: "Alice"}},
+			{User: entity.User{ID: "u2", Username: "Bob"}},
+		},
+	}
+
+	cases := []struct {
+		name    string
+		op      scimPatchOp
+		members []string
+		err     string
+	}{
+		{"add", scimPatchOp{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "u3"}]`)}, []string{"u1", "u2", "u3"}, ""},
+		{"replace", scimPatchOp{Op: "Replace", Path: "members", Value: json.RawMessage(`[{"value": "u3"}]`)}, []string{"u3"}, ""},
+		{"remove listed", scimPatchOp{Op: "remove", Path: "members", Value: json.RawMessage(`[{"value": "u1"}]`)}, []string{"u2"}, ""},
+		{"remove all", scimPatchOp{Op: "remove", Path: "members"}, []string{}, ""},
+		{"remove by filter", scimPatchOp{Op: "remove", Path: `members[display eq "bob"]`}, []string{"u1"}, ""},
+		{"same name", scimPatchOp{Op: "replace", Value: json.RawMessage(`{"displayName": "core"}`)}, []string{"u1", "u2"}, ""},
+		{"rename", scimPatchOp{Op: "replace", Path: "displayName", Value: json.RawMessage(`"platform"`)}, nil, "mutability"},
+		{"unknown op", scimPatchOp{Op: "move", Path: "members"}, nil, "invalidSyntax"},
+		{"unknown path", scimPatchOp{Op: "add", Path: "owners", Value: json.RawMessage(`[]`)}, nil, "invalidPath"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			change := newSCIMGroupChange(team)
+			err := change.apply(tc.op)
+
+			if tc.err != "" {
+				var scimErr *scimError
+				if !errors.As(err, &scimErr) || scimErr.scimType != tc.err {
+					t.Fatalf("expected a %s error, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(change.members) != len(tc.members) {
+				t.Fatalf("members = %v, want %v", change.members, tc.members)
+			}
+			for _, id := range tc.members {
+				if !change.members[id] {
+					t.Errorf("members = %v, want %v", change.members, tc.members)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package service
+
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+func validStrategy(strategy string) bool {
+	return strategy == entity.StrategyRandom || strategy == entity.StrategyLeastLoaded
+}
+
+
+func validPriority(priority string) bool {
+	switch priority {
+	case entity.PriorityLow, entity.PriorityNormal, entity.PriorityUrgent:
+		return true
+	}
+	return false
+}
+
+
+// strategyFor returns the strategy used for a PR. Urgent PRs always go to
+// the least loaded reviewers, whatever the team prefers.
+func strategyFor(settings entity.TeamSettings, priority string) string {
+	if priority == entity.PriorityUrgent {
+		return entity.StrategyLeastLoaded
+	}
+	return settings.AssignmentStrategy
+}
+
+
+func validRole(role string) bool {
+	switch role {
+	case entity.RoleRequired, entity.RoleOptional, entity.RoleShadow:
+		return true
+	}
+	return false
+}
+
+
+func validTeamRole(role string) bool {
+	return role == entity.TeamRoleMember || role == entity.TeamRoleOnboarding
+}
+
+
+func validUserRole(role string) bool {
+	switch role {
+	case entity.UserRoleMember, entity.UserRoleLead, entity.UserRoleBot:
+		return true
+	}
+	return false
+}
+
+
+// normalizeMembers validates the members. An empty user role, membership
+// role or a zero weight is left as is: storage keeps the stored value for
+// existing users and memberships and uses the default for new ones.
+func normalizeMembers(members []entity.TeamMember) error {
+	for i := range members {
+		m := &members[i]
+		if m.ID == "" {
+			return ErrInvalidTeam
+		}
+		if m.UserRole != "" && !validUserRole(m.UserRole) {
+			return ErrInvalidUserRole
+		}
+		if m.TeamRole == "" && m.IsOnboarding {
+			m.TeamRole = entity.TeamRoleOnboarding
+		}
+		if m.TeamRole != "" && !validTeamRole(m.TeamRole) {
+			return ErrInvalidTeam
+		}
+		if m.Weight < 0 {
+			return ErrInvalidTeam
+		}
+	}
+	return nil
+}
+
+
+// defaultMembers fills in the default user role, membership role and weight,
+// for callers that describe members completely.
+func defaultMembers(members []entity.TeamMember) {
+	for i := range members {
+		m := &members[i]
+		if m.UserRole == "" {
+			m.UserRole = entity.UserRoleMember
+		}
+		if m.TeamRole == "" {
+			m.TeamRole = entity.TeamRoleMember
+		}
+		if m.Weight == 0 {
+			m.Weight = 1
+		}
+	}
+}
+
+
+// findMember returns the membership of userID among members, or nil.
+func findMember(members []entity.TeamMember, userID string) *entity.TeamMember {
+	for i := range members {
+		if members[i].ID == userID {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+
+// filterCandidates returns active members that are not in the exclude set.
+// Onboarding members and bots are never picked as regular reviewers; leads
+// are left for filterLeads.
+func filterCandidates(members []entity.TeamMember, exclude map[string]bool) []entity.TeamMember {
+	candidates := make([]entity.TeamMember, 0, len(members))
+	for _, u := range members {
+		if !u.IsActive || u.TeamRole == entity.TeamRoleOnboarding { continue }
+		if u.UserRole == entity.UserRoleBot || u.UserRole == entity.UserRoleLead { continue }
+		if exclude[u.ID] { continue }
+
+		candidates = append(candidates, u)
+	}
+	return candidates
+}
+
+
+// filterShadows returns active onboarding members that are not in the
+// exclude set.
+func filterShadows(members []entity.TeamMember, exclude map[string]bool) []entity.TeamMember {
+	shadows := make([]entity.TeamMember, 0)
+	for _, u := range members {
+		if !u.IsActive || u.TeamRole != entity.TeamRoleOnboarding { continue }
+		if u.UserRole == entity.UserRoleBot { continue }
+		if exclude[u.ID] { continue }
+
+		shadows = append(shadows, u)
+	}
+	return shadows
+}
+
+
+// filterLeads returns active leads that are not in the exclude set; they are
+// the last resort when a team and its parents have no other candidates.
+func filterLeads(members []entity.TeamMember, exclude map[string]bool) []entity.TeamMember {
+	leads := make([]entity.TeamMember, 0)
+	for _, u := range members {
+		if !u.IsActive || u.UserRole != entity.UserRoleLead { continue }
+		if exclude[u.ID] { continue }
+
+		leads = append(leads, u)
+	}
+	return leads
+}
+
+
+// pickShadow returns an onboarding member to shadow a new PR, or "" when the
+// PR falls outside the team's shadow share.
+func pickShadow(settings entity.TeamSettings, members []entity.TeamMember, authorID string) string {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	if settings.ShadowShare <= 0 || r.Intn(100) >= settings.ShadowShare {
+		return ""
+	}
+
+	shadows := filterShadows(members, map[string]bool{authorID: true})
+	if len(shadows) == 0 {
+		return ""
+	}
+	return shadows[r.Intn(len(shadows))].ID
+}
+
+
+// countReviewers counts reviewers that take part in the review, leaving out
+// shadows.
+func countReviewers(reviewers []entity.Reviewer) int {
+	n := 0
+	for _, u := range reviewers {
+		if u.Role != entity.RoleShadow {
+			n++
+		}
+	}
+	return n
+}
+
+
+// pickCandidates returns the candidates for new required reviewers of a PR
+// of team, best first: its own members or, when none is left, those of the
+// nearest parent team and then the leads. Everything is read inside tx, so
+// members deactivated and reviews assigned earlier in tx are accounted for.
+func (s *Service) pickCandidates(ctx context.Context, tx *sqlx.Tx, team *entity.Team, exclude map[string]bool, strategy string) ([]entity.TeamMember, error) {
+	candidates := filterCandidates(team.Members, exclude)
+	if len(candidates) == 0 {
+		var err error
+		if candidates, err = s.escalateCandidates(ctx, tx, team.Name, exclude, filterCandidates, true); err != nil {
+			return nil, err
+		}
+	}
+	return s.orderCandidates(ctx, tx, candidates, strategy)
+}
+
+
+// orderCandidates shuffles candidates so that members with a higher weight
+// tend to come first and, for the least loaded strategy, sorts them by open
+// reviews per unit of weight. The load covers all of the member's teams.
+// Callers take from the front.
+func (s *Service) orderCandidates(ctx context.Context, tx *sqlx.Tx, candidates []entity.TeamMember, strategy string) ([]entity.TeamMember, error) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// Weighted shuffle: sorting by u^(1/w) picks members in proportion to w.
+	keys := make(map[string]float64, len(candidates))
+	for _, u := range candidates {
+		keys[u.ID] = math.Pow(r.Float64(), 1/float64(weightOf(u)))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return keys[candidates[i].ID] > keys[candidates[j].ID]
+	})
+
+	if strategy != entity.StrategyLeastLoaded || len(candidates) < 2 {
+		return candidates, nil
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for _, u := range candidates {
+		ids = append(ids, u.ID)
+	}
+
+	load, err := s.repo.GetReviewLoadTx(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	openReviews := make(map[string]int, len(load))
+	for _, l := range load {
+		openReviews[l.UserID] = l.OpenReviews
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		return openReviews[a.ID]*weightOf(b) < openReviews[b.ID]*weightOf(a)
+	})
+	return candidates, nil
+}
+
+
+func weightOf(m entity.TeamMember) int {
+	if m.Weight < 1 {
+		return 1
+	}
+	return m.Weight
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+func shadowMember(id, teamRole, userRole string, active bool) entity.TeamMember {
+	return entity.TeamMember{
+		User:     entity.User{ID: id, IsActive: active, UserRole: userRole},
+		TeamRole: teamRole,
+	}
+}
+
+
+func TestPickShadow(t *testing.T) {
+	members := []entity.TeamMember{
+		shadowMember("author", entity.TeamRoleOnboarding, entity.UserRoleMember, true),
+		shadowMember("bob", entity.TeamRoleMember, entity.UserRoleMember, true),
+		shadowMember("idle", entity.TeamRoleOnboarding, entity.UserRoleMember, false),
+		shadowMember("bot", entity.TeamRoleOnboarding, entity.UserRoleBot, true),
+		shadowMember("olga", entity.TeamRoleOnboarding, entity.UserRoleMember, true),
+	}
+
+	for i := 0; i < 50; i++ {
+		if got := pickShadow(entity.TeamSettings{ShadowShare: 100}, members, "author"); got != "olga" {
+			t.Fatalf("share 100: got %q, want olga", got)
+		}
+		if got := pickShadow(entity.TeamSettings{ShadowShare: 0}, members, "author"); got != "" {
+			t.Fatalf("share 0: got %q, want none", got)
+		}
+	}
+
+	if got := pickShadow(entity.TeamSettings{ShadowShare: 100}, members[:4], "author"); got != "" {
+		t.Errorf("no eligible onboarding members: got %q, want none", got)
+	}
+
+	// Over many PRs the share of shadowed ones stays near the setting.
+	picked := 0
+	for i := 0; i < 2000; i++ {
+		if pickShadow(entity.TeamSettings{ShadowShare: 30}, members, "author") != "" {
+			picked++
+		}
+	}
+	if picked < 450 || picked > 750 {
+		t.Errorf("share 30: %d of 2000 PRs got a shadow", picked)
+	}
+}
+
+
+func TestCountReviewers(t *testing.T) {
+	reviewers := []entity.Reviewer{
+		{Role: entity.RoleRequired},
+		{Role: entity.RoleShadow},
+		{Role: entity.RoleOptional},
+	}
+	if got := countReviewers(reviewers); got != 2 {
+		t.Errorf("countReviewers = %d, want 2", got)
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+const maxBulkOperations = 200
+
+
+const (
+	BulkMerge    = "merge"
+	BulkClose    = "close"
+	BulkReassign = "reassign"
+)
+
+
+var (
+	ErrInvalidOperation = errors.New("invalid bulk operation")
+	ErrRolledBack       = errors.New("rolled back because another operation failed")
+)
+
+
+type BulkOperation struct {
+	Op        string `json:"op"`
+	PRID      string `json:"pull_request_id"`
+	OldUserID string `json:"old_user_id,omitempty"`
+	NewUserID string `json:"new_user_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+
+type BulkResult struct {
+	Op         string
+	PRID       string
+	PR         *entity.PullRequest
+	ReplacedBy string
+	Err        error
+}
+
+
+// Bulk runs ops in order. In atomic mode all of them share one transaction:
+// the first failure rolls everything back and the remaining results carry
+// ErrRolledBack. Otherwise each operation commits on its own. The returned
+// flag reports whether any changes were committed.
+func (s *Service) Bulk(ctx context.Context, ops []BulkOperation, atomic bool) ([]BulkResult, bool, error) {
+	if len(ops) == 0 || len(ops) > maxBulkOperations {
+		return nil, false, ErrInvalidOperation
+	}
+
+	results := make([]BulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = BulkResult{Op: op.Op, PRID: op.PRID}
+	}
+
+	if atomic {
+		committed, err := s.bulkAtomic(ctx, ops, results)
+		if err != nil {
+			return nil, false, err
+		}
+		if !committed {
+			return results, false, nil
+		}
+	} else {
+		committed := false
+		for i, op := range ops {
+			if results[i].Err = s.bulkSingle(ctx, op, &results[i]); results[i].Err == nil {
+				committed = true
+			}
+		}
+		if !committed {
+			return results, false, nil
+		}
+	}
+
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		pr, err := s.repo.GetPR(ctx, results[i].PRID)
+		if err != nil {
+			return nil, true, err
+		}
+		results[i].PR = pr
+	}
+
+	return results, true, nil
+}
+
+
+func (s *Service) bulkAtomic(ctx context.Context, ops []BulkOperation, results []BulkResult) (bool, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	for i, op := range ops {
+		if err := s.bulkApply(ctx, tx, op, &results[i]); err != nil {
+			results[i].Err = err
+			for j := range results {
+				if j != i {
+					results[j].Err = ErrRolledBack
+					results[j].ReplacedBy = ""
+				}
+			}
+			return false, nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+
+func (s *Service) bulkSingle(ctx context.Context, op BulkOperation, result *BulkResult) error {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.bulkApply(ctx, tx, op, result); err != nil {
+		result.ReplacedBy = ""
+		return err
+	}
+
+	return tx.Commit()
+}
+
+
+func (s *Service) bulkApply(ctx context.Context, tx *sqlx.Tx, op BulkOperation, result *BulkResult) error {
+	if op.PRID == "" {
+		return ErrInvalidOperation
+	}
+
+	switch op.Op {
+	case BulkMerge:
+		return s.mergeTx(ctx, tx, op.PRID)
+
+	case BulkClose:
+		return s.closeTx(ctx, tx, op.PRID)
+
+	case BulkReassign:
+		if op.OldUserID == "" {
+			return ErrInvalidOperation
+		}
+		if op.Reason == "" {
+			op.Reason = entity.ReasonOther
+		}
+		if !reassignReasons[op.Reason] {
+			return ErrInvalidReason
+		}
+
+		record, err := s.reassignTx(ctx, tx, ReassignInput{
+			PRID:      op.PRID,
+			OldUserID: op.OldUserID,
+			NewUserID: op.NewUserID,
+			Reason:    op.Reason,
+			Comment:   op.Comment,
+		})
+		if err != nil {
+			return err
+		}
+		result.ReplacedBy = record.NewUserID
+		return nil
+	}
+
+	return ErrInvalidOperation
+}
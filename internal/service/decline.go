@@ -0,0 +1,78 @@
+package service
+
+
+import (
+	"context"
+	"time"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+const declineWindow = 24 * time.Hour
+
+
+// DeclineReview lets an assigned reviewer hand the PR back. The replacement
+// is picked by the usual selection logic and the decline is recorded in the
+// reviewer's stats.
+func (s *Service) DeclineReview(ctx context.Context, prID, userID, reason, comment string) (*ReassignResult, error) {
+	if !reassignReasons[reason] {
+		return nil, ErrInvalidReason
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if s.cfg.DeclineDailyLimit > 0 {
+		// Serializes concurrent declines of the same user so the limit holds.
+		if err := s.repo.LockUser(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+
+		declines, err := s.repo.CountDeclines(ctx, tx, userID, time.Now().Add(-declineWindow))
+		if err != nil {
+			return nil, err
+		}
+		if declines >= s.cfg.DeclineDailyLimit {
+			return nil, ErrDeclineLimit
+		}
+	}
+
+	record, err := s.reassignTx(ctx, tx, ReassignInput{
+		PRID:      prID,
+		OldUserID: userID,
+		Reason:    reason,
+		Comment:   comment,
+		Declined:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	updatedPR, err := s.repo.GetPR(ctx, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReassignResult{
+		PR:         updatedPR,
+		ReplacedBy: record.NewUserID,
+		Propagated: []entity.Reassignment{},
+	}, nil
+}
+
+
+func (s *Service) GetReviewerStats(ctx context.Context, userID string) (*entity.ReviewerStats, error) {
+	if _, err := s.repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetReviewerStats(ctx, userID, time.Now().Add(-declineWindow))
+}
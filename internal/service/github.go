@@ -0,0 +1,274 @@
+package service
+
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/github"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+
+var (
+	ErrGitHubImport   = errors.New("github import failed")
+	ErrGitHubDisabled = errors.New("github import is not configured")
+)
+
+
+// GitHubSource lists the teams of a GitHub organization and their members.
+// It is implemented by github.Client.
+type GitHubSource interface {
+	ListTeams(ctx context.Context, org string) ([]github.Team, error)
+	ListTeamMembers(ctx context.Context, org, teamSlug string) ([]github.Member, error)
+}
+
+
+type GitHubImportResult struct {
+	Teams        []string `json:"teams"`
+	CreatedTeams []string `json:"created_teams"`
+	CreatedUsers []string `json:"created_users"`
+
+	// SkippedTeams are archived here and left alone.
+	SkippedTeams []string `json:"skipped_teams"`
+}
+
+
+// ImportGitHubOrg upserts the teams of a GitHub organization, named by their
+// slugs, together with their parents and direct members. New teams get
+// default settings; existing ones keep their settings and members missing on
+// GitHub. Logins are mapped to user IDs through the stored mapping; unmapped
+// logins become users with the login as ID and are added to the mapping.
+// Departed users are not added back to teams.
+func (s *Service) ImportGitHubOrg(ctx context.Context, org string) (*GitHubImportResult, error) {
+	if s.cfg.GitHub == nil {
+		return nil, ErrGitHubDisabled
+	}
+
+	teams, err := s.cfg.GitHub.ListTeams(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGitHubImport, err)
+	}
+
+	members := make(map[string][]github.Member, len(teams))
+	for _, t := range teams {
+		if members[t.Slug], err = s.cfg.GitHub.ListTeamMembers(ctx, org, t.Slug); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrGitHubImport, err)
+		}
+	}
+	teams = parentsFirst(teams)
+	direct := directMembers(teams, members)
+
+	logins, err := s.repo.GetGitHubLogins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users to make sure of, keyed by ID, and logins missing from the mapping.
+	users := make(map[string]entity.User)
+	newLogins := make(map[string]string)
+	userID := func(m github.Member) string {
+		key := strings.ToLower(m.Login)
+		id, ok := logins[key]
+		if !ok {
+			id = m.Login
+			logins[key] = id
+			newLogins[key] = id
+		}
+		if _, ok := users[id]; !ok {
+			role := entity.UserRoleMember
+			if m.Type == "Bot" {
+				role = entity.UserRoleBot
+			}
+			users[id] = entity.User{ID: id, Username: m.Login, IsActive: true, UserRole: role}
+		}
+		return id
+	}
+
+	teamMembers := make(map[string][]string, len(teams))
+	for _, t := range teams {
+		for _, m := range direct[t.Slug] {
+			teamMembers[t.Slug] = append(teamMembers[t.Slug], userID(m))
+		}
+	}
+
+	ids := make([]string, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	departed := make(map[string]bool)
+	known, err := s.repo.GetUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range known {
+		if u.DepartedAt != nil {
+			departed[u.ID] = true
+		}
+	}
+
+	current := make(map[string]*entity.Team, len(teams))
+	for _, t := range teams {
+		team, err := s.repo.GetTeam(ctx, t.Slug)
+		if err == nil {
+			current[t.Slug] = team
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	res := &GitHubImportResult{
+		Teams:        make([]string, 0, len(teams)),
+		CreatedTeams: make([]string, 0),
+		CreatedUsers: make([]string, 0),
+		SkippedTeams: make([]string, 0),
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		created, err := s.repo.EnsureUser(ctx, tx, users[id])
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			res.CreatedUsers = append(res.CreatedUsers, id)
+		}
+	}
+
+	for login, id := range newLogins {
+		if err := s.repo.SetGitHubLogin(ctx, tx, login, id); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range teams {
+		var parent *string
+		if t.Parent != nil {
+			parent = &t.Parent.Slug
+		}
+
+		team, ok := current[t.Slug]
+		switch {
+		case !ok:
+			team = &entity.Team{Name: t.Slug, ParentTeam: parent}
+			if err := normalizeSettings(&team.TeamSettings); err != nil {
+				return nil, err
+			}
+			if err := s.repo.CreateTeam(ctx, tx, *team); err != nil {
+				return nil, err
+			}
+			res.CreatedTeams = append(res.CreatedTeams, t.Slug)
+
+		case team.ArchivedAt != nil:
+			res.SkippedTeams = append(res.SkippedTeams, t.Slug)
+			continue
+
+		case strValue(team.ParentTeam) != strValue(parent):
+			team.ParentTeam = parent
+			if err := s.repo.UpsertTeam(ctx, tx, *team); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, id := range teamMembers[t.Slug] {
+			if departed[id] {
+				continue
+			}
+			if err := s.repo.AddMembership(ctx, tx, t.Slug, id); err != nil {
+				return nil, err
+			}
+		}
+		res.Teams = append(res.Teams, t.Slug)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+
+// SetGitHubLogin maps a GitHub login to an existing user for later imports.
+func (s *Service) SetGitHubLogin(ctx context.Context, login, userID string) error {
+	if login == "" {
+		return ErrInvalidUser
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.repo.SetGitHubLogin(ctx, tx, strings.ToLower(login), userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+
+// parentsFirst orders teams so that every parent comes before its children.
+func parentsFirst(teams []github.Team) []github.Team {
+	parents := make(map[string]string, len(teams))
+	for _, t := range teams {
+		if t.Parent != nil {
+			parents[t.Slug] = t.Parent.Slug
+		}
+	}
+
+	depth := func(slug string) int {
+		d := 0
+		for p, ok := parents[slug]; ok && d < len(teams); p, ok = parents[p] {
+			d++
+		}
+		return d
+	}
+
+	sorted := append([]github.Team(nil), teams...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return depth(sorted[i].Slug) < depth(sorted[j].Slug)
+	})
+	return sorted
+}
+
+
+// directMembers drops from every team the members of its child teams, which
+// GitHub lists as members of the parent too.
+func directMembers(teams []github.Team, members map[string][]github.Member) map[string][]github.Member {
+	inChildren := make(map[string]map[string]bool, len(teams))
+	for _, t := range teams {
+		if t.Parent == nil {
+			continue
+		}
+		if inChildren[t.Parent.Slug] == nil {
+			inChildren[t.Parent.Slug] = make(map[string]bool)
+		}
+		for _, m := range members[t.Slug] {
+			inChildren[t.Parent.Slug][strings.ToLower(m.Login)] = true
+		}
+	}
+
+	direct := make(map[string][]github.Member, len(teams))
+	for _, t := range teams {
+		for _, m := range members[t.Slug] {
+			if !inChildren[t.Slug][strings.ToLower(m.Login)] {
+				direct[t.Slug] = append(direct[t.Slug], m)
+			}
+		}
+	}
+	return direct
+}
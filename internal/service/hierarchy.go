@@ -0,0 +1,195 @@
+package service
+
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+// SetTeamParent puts the team under parent, or makes it a top-level team
+// when parent is empty. Moves that would create a cycle are rejected. The
+// team and the new parent chain stay locked from the check to the update, so
+// concurrent moves cannot close a cycle either.
+func (s *Service) SetTeamParent(ctx context.Context, name, parent string) (*entity.Team, error) {
+	if parent == name {
+		return nil, ErrInvalidTeam
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var parentRef *string
+	if parent == "" {
+		if err := s.repo.LockTeams(ctx, tx, name); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.repo.LockTeams(ctx, tx, name, parent); err != nil {
+			return nil, err
+		}
+
+		ancestors, err := s.repo.LockTeamAncestors(ctx, tx, parent)
+		if err != nil {
+			return nil, err
+		}
+		if contains(ancestors, name) {
+			return nil, ErrInvalidTeam
+		}
+		parentRef = &parent
+	}
+
+	if err := s.repo.SetTeamParent(ctx, tx, name, parentRef); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTeam(ctx, name)
+}
+
+
+// GetTeamTree returns the team with all of its subteams nested under it.
+// Every team of the tree carries a summary of its own subtree; load counts
+// the open reviews of its members across all their teams.
+func (s *Service) GetTeamTree(ctx context.Context, name string) (*entity.Team, error) {
+	root, err := s.repo.GetTeam(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.repo.GetTeamDescendants(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	teams := []*entity.Team{root}
+	byName := map[string]*entity.Team{name: root}
+	for _, n := range names {
+		team, err := s.repo.GetTeam(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+		byName[n] = team
+	}
+
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, t := range teams {
+		for _, m := range t.Members {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				ids = append(ids, m.ID)
+			}
+		}
+	}
+
+	load, err := s.repo.GetReviewLoad(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	openReviews := make(map[string]int, len(load))
+	for _, l := range load {
+		openReviews[l.UserID] = l.OpenReviews
+	}
+
+	// Descendants come nearest first, so walking backwards attaches every
+	// subteam only after its own subteams are in place.
+	for i := len(teams) - 1; i > 0; i-- {
+		parent := byName[*teams[i].ParentTeam]
+		parent.Subteams = append(parent.Subteams, *teams[i])
+	}
+
+	summarize(root, openReviews)
+	return root, nil
+}
+
+
+// summarize fills the summaries of team and its subteams and returns the
+// members of the subtree with their active flag.
+func summarize(team *entity.Team, openReviews map[string]int) map[string]bool {
+	members := make(map[string]bool)
+	for _, m := range team.Members {
+		members[m.ID] = members[m.ID] || m.IsActive
+	}
+
+	sort.Slice(team.Subteams, func(i, j int) bool {
+		return team.Subteams[i].Name < team.Subteams[j].Name
+	})
+
+	summary := &entity.TeamSummary{Teams: 1}
+	for i := range team.Subteams {
+		for id, active := range summarize(&team.Subteams[i], openReviews) {
+			members[id] = members[id] || active
+		}
+		summary.Teams += team.Subteams[i].Summary.Teams
+	}
+
+	for id, active := range members {
+		summary.Members++
+		if active {
+			summary.ActiveMembers++
+		}
+		summary.OpenReviews += openReviews[id]
+	}
+
+	team.Summary = summary
+	return members
+}
+
+
+// escalateCandidates walks up the parent chain of teamName and returns the
+// candidates of the nearest team that has any. With withLeads, the leads of
+// teamName and then of its parents are tried last. Archived parents are
+// skipped. The teams are read inside tx.
+func (s *Service) escalateCandidates(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	teamName string,
+	exclude map[string]bool,
+	filter func([]entity.TeamMember, map[string]bool) []entity.TeamMember,
+	withLeads bool,
+) ([]entity.TeamMember, error) {
+	ancestors, err := s.repo.GetTeamAncestorsTx(ctx, tx, teamName)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([]*entity.Team, 0, len(ancestors)+1)
+	for _, name := range append([]string{teamName}, ancestors...) {
+		team, err := s.repo.GetTeamTx(ctx, tx, name)
+		if err != nil {
+			return nil, err
+		}
+		if team.ArchivedAt != nil && name != teamName {
+			continue
+		}
+		chain = append(chain, team)
+	}
+
+	for _, team := range chain[1:] {
+		if candidates := filter(team.Members, exclude); len(candidates) > 0 {
+			return candidates, nil
+		}
+	}
+
+	if withLeads {
+		for _, team := range chain {
+			if leads := filterLeads(team.Members, exclude); len(leads) > 0 {
+				return leads, nil
+			}
+		}
+	}
+	return []entity.TeamMember{}, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+
+// ListPRs returns one page of PRs matching f and the cursor of the next page,
+// which is empty on the last page.
+func (s *Service) ListPRs(ctx context.Context, f entity.PRFilter, cursor string) ([]entity.PullRequest, string, error) {
+	if f.SortBy == "" {
+		f.SortBy = entity.SortByCreatedAt
+	}
+	if f.SortBy != entity.SortByCreatedAt && f.SortBy != entity.SortByName {
+		return nil, "", ErrInvalidFilter
+	}
+
+	if f.Limit == 0 {
+		f.Limit = defaultListLimit
+	}
+	if f.Limit < 0 || f.Limit > maxListLimit {
+		return nil, "", ErrInvalidFilter
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil || after.SortBy != f.SortBy || after.Desc != f.Desc {
+			return nil, "", ErrInvalidFilter
+		}
+		f.After = after
+	}
+
+	limit := f.Limit
+	f.Limit++
+
+	prs, err := s.repo.ListPRs(ctx, f)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(prs) <= limit {
+		return prs, "", nil
+	}
+
+	prs = prs[:limit]
+	last := prs[limit-1]
+
+	next := entity.PRCursor{SortBy: f.SortBy, Desc: f.Desc, ID: last.ID, Value: last.CreatedAt.Format(time.RFC3339Nano)}
+	if f.SortBy == entity.SortByName {
+		next.Value = last.Name
+	}
+
+	return prs, encodeCursor(next), nil
+}
+
+
+func encodeCursor(c entity.PRCursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+
+func decodeCursor(cursor string) (*entity.PRCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var c entity.PRCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
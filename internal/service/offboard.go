@@ -0,0 +1,152 @@
+package service
+
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+type OffboardResult struct {
+	User       *entity.User
+	Reassigned []entity.Reassignment
+	Skipped    []string
+	LeftTeams  []string
+}
+
+
+// OffboardUser marks the user as departed: they are deactivated, removed from
+// all teams and their open reviews are handed to other members in the same
+// transaction. PRs without a replacement candidate are reported as skipped.
+// Their personal data is kept until the retention period is over.
+func (s *Service) OffboardUser(ctx context.Context, userID string) (*OffboardResult, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.repo.LockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DepartedAt != nil {
+		return nil, ErrUserDeparted
+	}
+
+	if err := s.repo.MarkDeparted(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	res := &OffboardResult{LeftTeams: make([]string, 0)}
+
+	if res.Reassigned, res.Skipped, err = s.reassignAll(ctx, tx, userID, "", entity.ReasonOffboarded); err != nil {
+		return nil, err
+	}
+
+	left, err := s.repo.RemoveMemberships(ctx, tx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	if left != nil {
+		res.LeftTeams = left
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if res.User, err = s.repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+
+// AnonymizeDeparted replaces the username of users who departed more than
+// the retention period ago with a random pseudonym. Their ID stays, as it is
+// referenced from outside: GitHub logins, SCIM clients and audit logs.
+func (s *Service) AnonymizeDeparted(ctx context.Context) error {
+	if s.cfg.AnonymizeAfter <= 0 {
+		return nil
+	}
+
+	ids, err := s.repo.GetAnonymizableIDs(ctx, time.Now().Add(-s.cfg.AnonymizeAfter))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.anonymize(ctx, id); err != nil {
+			log.Printf("offboarding: anonymization of a departed user failed: %v", err)
+		}
+	}
+	return nil
+}
+
+
+func (s *Service) anonymize(ctx context.Context, userID string) error {
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.repo.LockUser(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	if err := s.repo.AnonymizeUser(ctx, tx, userID, pseudonym); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+
+// newPseudonym returns a random username that cannot be traced back to the
+// user.
+func newPseudonym() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "departed-" + hex.EncodeToString(b), nil
+}
+
+
+// rejectDeparted fails with ErrUserDeparted if any of the members has been
+// offboarded; departed users cannot rejoin teams.
+func (s *Service) rejectDeparted(ctx context.Context, members []entity.TeamMember) error {
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.ID)
+	}
+
+	users, err := s.repo.GetUsers(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.DepartedAt != nil {
+			return ErrUserDeparted
+		}
+	}
+	return nil
+}
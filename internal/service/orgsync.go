@@ -0,0 +1,535 @@
+package service
+
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+
+var ErrInvalidOrg = errors.New("invalid org file")
+
+
+// Row kinds of the org file.
+const (
+	orgRowTeam   = "team"
+	orgRowMember = "member"
+)
+
+
+// Actions of a sync plan.
+const (
+	SyncCreateTeam   = "create_team"
+	SyncUpdateTeam   = "update_team"
+	SyncArchiveTeam  = "archive_team"
+	SyncAddMember    = "add_member"
+	SyncUpdateMember = "update_member"
+	SyncRemoveMember = "remove_member"
+	SyncUpdateUser   = "update_user"
+)
+
+
+// OrgSpec is the desired org structure, teams in file order.
+type OrgSpec struct {
+	Teams []entity.Team
+}
+
+
+type SyncChange struct {
+	Action string `json:"action"`
+	Team   string `json:"team_name,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+
+type SyncResult struct {
+	Plan    []SyncChange
+	Applied bool
+}
+
+
+// ParseOrgCSV reads an org file. The first row names the columns; kind and
+// team_name are required, the others are parent_team, settings, user_id,
+// username, user_role, team_role and weight. "team" rows declare a team with
+// its parent and settings written as key=value pairs separated by ";", using
+// the names of /team/settings. "member" rows list the team's members. Lines
+// starting with # are ignored.
+func ParseOrgCSV(r io.Reader) (*OrgSpec, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOrg, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["kind"]; !ok {
+		return nil, fmt.Errorf("%w: missing kind column", ErrInvalidOrg)
+	}
+	if _, ok := columns["team_name"]; !ok {
+		return nil, fmt.Errorf("%w: missing team_name column", ErrInvalidOrg)
+	}
+
+	spec := &OrgSpec{}
+	teams := make(map[string]int)
+	members := make(map[string][]entity.TeamMember)
+	seen := make(map[string]bool)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidOrg, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%w: line %d: %s", ErrInvalidOrg, line, fmt.Sprintf(format, args...))
+		}
+
+		teamName := get("team_name")
+		if teamName == "" {
+			return nil, fail("missing team_name")
+		}
+
+		switch get("kind") {
+		case orgRowTeam:
+			if _, ok := teams[teamName]; ok {
+				return nil, fail("team %s is declared twice", teamName)
+			}
+
+			settings, err := parseSettings(get("settings"))
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+
+			team := entity.Team{Name: teamName, TeamSettings: settings}
+			if parent := get("parent_team"); parent != "" {
+				team.ParentTeam = &parent
+			}
+
+			teams[teamName] = len(spec.Teams)
+			spec.Teams = append(spec.Teams, team)
+
+		case orgRowMember:
+			m := entity.TeamMember{
+				User: entity.User{
+					ID:       get("user_id"),
+					Username: get("username"),
+					IsActive: true,
+					UserRole: get("user_role"),
+				},
+				TeamRole: get("team_role"),
+			}
+			if m.ID == "" || m.Username == "" {
+				return nil, fail("member needs user_id and username")
+			}
+			if w := get("weight"); w != "" {
+				if m.Weight, err = strconv.Atoi(w); err != nil {
+					return nil, fail("invalid weight %q", w)
+				}
+			}
+
+			key := teamName + "\x00" + m.ID
+			if seen[key] {
+				return nil, fail("user %s is listed twice in team %s", m.ID, teamName)
+			}
+			seen[key] = true
+
+			members[teamName] = append(members[teamName], m)
+
+		default:
+			return nil, fail("unknown kind %q", get("kind"))
+		}
+	}
+
+	for name, list := range members {
+		i, ok := teams[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: members of undeclared team %s", ErrInvalidOrg, name)
+		}
+		spec.Teams[i].Members = list
+	}
+	for i := range spec.Teams {
+		if spec.Teams[i].Members == nil {
+			spec.Teams[i].Members = []entity.TeamMember{}
+		}
+	}
+	return spec, nil
+}
+
+
+// parseSettings turns "reviewers_count=3;sla_policy=reassign" into settings.
+// Unknown keys are rejected.
+func parseSettings(s string) (entity.TeamSettings, error) {
+	var settings entity.TeamSettings
+
+	values := make(map[string]interface{})
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return settings, fmt.Errorf("setting %q is not key=value", pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		if n, err := strconv.Atoi(value); err == nil {
+			values[key] = n
+		} else {
+			values[key] = value
+		}
+	}
+
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return settings, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&settings); err != nil {
+		return settings, fmt.Errorf("invalid settings: %v", err)
+	}
+	return settings, nil
+}
+
+
+// SyncOrg compares the desired org structure with the database and returns
+// the plan of changes. With apply the plan is carried out in one transaction,
+// which locks teams, memberships and users before the plan is computed so
+// that concurrent changes cannot make it stale.
+//
+// Teams in the file get exactly the listed settings, parent and members;
+// settings left out fall back to their defaults. Members missing from the
+// file leave the team and keep their open reviews. With prune, teams that
+// are not in the file are archived. Syncing the same file again yields an
+// empty plan.
+func (s *Service) SyncOrg(ctx context.Context, spec *OrgSpec, apply, prune bool) (*SyncResult, error) {
+	byName := make(map[string]*entity.Team, len(spec.Teams))
+	for i := range spec.Teams {
+		team := &spec.Teams[i]
+		if team.Name == "" || byName[team.Name] != nil {
+			return nil, fmt.Errorf("%w: empty or repeated team name", ErrInvalidOrg)
+		}
+		if err := normalizeSettings(&team.TeamSettings); err != nil {
+			return nil, fmt.Errorf("%w: team %s: %v", ErrInvalidOrg, team.Name, err)
+		}
+		if err := normalizeMembers(team.Members); err != nil {
+			return nil, fmt.Errorf("%w: team %s: %v", ErrInvalidOrg, team.Name, err)
+		}
+		defaultMembers(team.Members)
+		byName[team.Name] = team
+	}
+
+	var tx *sqlx.Tx
+	if apply {
+		var err error
+		if tx, err = s.repo.BeginTx(ctx); err != nil {
+			return nil, err
+		}
+
+		defer tx.Rollback()
+
+		if err := s.repo.LockOrg(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err := s.orgOrder(ctx, spec, byName)
+	if err != nil {
+		return nil, err
+	}
+
+	// A user listed in several teams must be described the same way.
+	users := make(map[string]entity.User)
+	ids := make([]string, 0)
+	for _, team := range order {
+		for _, m := range team.Members {
+			u, ok := users[m.ID]
+			if !ok {
+				users[m.ID] = m.User
+				ids = append(ids, m.ID)
+				continue
+			}
+			if u.Username != m.Username || u.UserRole != m.UserRole {
+				return nil, fmt.Errorf("%w: user %s is described differently in two teams", ErrInvalidOrg, m.ID)
+			}
+		}
+	}
+
+	existing, err := s.repo.GetUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]entity.User, len(existing))
+	for _, u := range existing {
+		if u.DepartedAt != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUserDeparted, u.ID)
+		}
+		current[u.ID] = u
+	}
+
+	plan := make([]SyncChange, 0)
+	upsertTeams := make([]entity.Team, 0)
+	memberTeams := make(map[string]bool)
+	removals := make([]SyncChange, 0)
+
+	for _, id := range ids {
+		want := users[id]
+		have, ok := current[id]
+		if !ok {
+			continue
+		}
+
+		var changed []string
+		if have.Username != want.Username {
+			changed = append(changed, fmt.Sprintf("username %s -> %s", have.Username, want.Username))
+		}
+		if have.UserRole != want.UserRole {
+			changed = append(changed, fmt.Sprintf("user_role %s -> %s", have.UserRole, want.UserRole))
+		}
+		if len(changed) > 0 {
+			plan = append(plan, SyncChange{Action: SyncUpdateUser, UserID: id, Detail: strings.Join(changed, ", ")})
+		}
+	}
+
+	for _, want := range order {
+		have, err := s.repo.GetTeam(ctx, want.Name)
+		if errors.Is(err, storage.ErrNotFound) {
+			plan = append(plan, SyncChange{Action: SyncCreateTeam, Team: want.Name})
+			upsertTeams = append(upsertTeams, *want)
+
+			for _, m := range want.Members {
+				plan = append(plan, SyncChange{Action: SyncAddMember, Team: want.Name, UserID: m.ID})
+			}
+			memberTeams[want.Name] = len(want.Members) > 0
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var changed []string
+		if have.TeamSettings != want.TeamSettings {
+			changed = append(changed, "settings")
+		}
+		if strValue(have.ParentTeam) != strValue(want.ParentTeam) {
+			changed = append(changed, fmt.Sprintf("parent_team %q -> %q", strValue(have.ParentTeam), strValue(want.ParentTeam)))
+		}
+		if have.ArchivedAt != nil {
+			changed = append(changed, "unarchive")
+		}
+		if len(changed) > 0 {
+			plan = append(plan, SyncChange{Action: SyncUpdateTeam, Team: want.Name, Detail: strings.Join(changed, ", ")})
+			upsertTeams = append(upsertTeams, *want)
+		}
+
+		listed := make(map[string]bool, len(want.Members))
+		for _, m := range want.Members {
+			listed[m.ID] = true
+
+			old := findMember(have.Members, m.ID)
+			switch {
+			case old == nil:
+				plan = append(plan, SyncChange{Action: SyncAddMember, Team: want.Name, UserID: m.ID})
+				memberTeams[want.Name] = true
+			case old.TeamRole != m.TeamRole || old.Weight != m.Weight:
+				plan = append(plan, SyncChange{
+					Action: SyncUpdateMember,
+					Team:   want.Name,
+					UserID: m.ID,
+					Detail: fmt.Sprintf("team_role %s -> %s, weight %d -> %d", old.TeamRole, m.TeamRole, old.Weight, m.Weight),
+				})
+				memberTeams[want.Name] = true
+			}
+		}
+
+		for _, m := range have.Members {
+			if !listed[m.ID] {
+				change := SyncChange{Action: SyncRemoveMember, Team: want.Name, UserID: m.ID}
+				plan = append(plan, change)
+				removals = append(removals, change)
+			}
+		}
+	}
+
+	// User changes are written together with one of their memberships.
+	for _, c := range plan {
+		if c.Action != SyncUpdateUser {
+			continue
+		}
+		for _, team := range order {
+			if findMember(team.Members, c.UserID) != nil {
+				memberTeams[team.Name] = true
+				break
+			}
+		}
+	}
+
+	archive := make([]string, 0)
+	if prune {
+		names, err := s.repo.ListTeamNames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if byName[name] != nil {
+				continue
+			}
+			team, err := s.repo.GetTeam(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			if team.ArchivedAt == nil {
+				plan = append(plan, SyncChange{Action: SyncArchiveTeam, Team: name})
+				archive = append(archive, name)
+			}
+		}
+	}
+
+	res := &SyncResult{Plan: plan}
+	if !apply || len(plan) == 0 {
+		return res, nil
+	}
+
+	for _, team := range upsertTeams {
+		if err := s.repo.UpsertTeam(ctx, tx, team); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, team := range order {
+		if !memberTeams[team.Name] {
+			continue
+		}
+
+		// The file does not manage activity; existing users keep theirs.
+		members := make([]entity.TeamMember, len(team.Members))
+		copy(members, team.Members)
+		for i := range members {
+			if u, ok := current[members[i].ID]; ok {
+				members[i].IsActive = u.IsActive
+			}
+		}
+
+		if err := s.repo.AddTeamMembers(ctx, tx, team.Name, members); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range removals {
+		if err := s.repo.RemoveTeamMember(ctx, tx, c.Team, c.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(archive) > 0 {
+		if err := s.repo.ArchiveTeams(ctx, tx, archive); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	res.Applied = true
+	return res, nil
+}
+
+
+// orgOrder returns the teams of spec with every parent from the file before
+// its subteams. Parents outside the file must exist, and the resulting
+// hierarchy must have no cycles.
+func (s *Service) orgOrder(ctx context.Context, spec *OrgSpec, byName map[string]*entity.Team) ([]*entity.Team, error) {
+	parentOf := func(name string) (string, error) {
+		if team, ok := byName[name]; ok {
+			return strValue(team.ParentTeam), nil
+		}
+		team, err := s.repo.GetTeam(ctx, name)
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", fmt.Errorf("%w: unknown parent team %s", ErrInvalidOrg, name)
+		}
+		if err != nil {
+			return "", err
+		}
+		return strValue(team.ParentTeam), nil
+	}
+
+	for _, team := range spec.Teams {
+		seen := map[string]bool{team.Name: true}
+		for cur := strValue(team.ParentTeam); cur != ""; {
+			if seen[cur] {
+				return nil, fmt.Errorf("%w: team %s is its own ancestor", ErrInvalidOrg, team.Name)
+			}
+			seen[cur] = true
+
+			next, err := parentOf(cur)
+			if err != nil {
+				return nil, err
+			}
+			cur = next
+		}
+	}
+
+	order := make([]*entity.Team, 0, len(spec.Teams))
+	placed := make(map[string]bool, len(spec.Teams))
+
+	var place func(team *entity.Team)
+	place = func(team *entity.Team) {
+		if placed[team.Name] {
+			return
+		}
+		placed[team.Name] = true
+
+		if parent, ok := byName[strValue(team.ParentTeam)]; ok {
+			place(parent)
+		}
+		order = append(order, team)
+	}
+
+	for i := range spec.Teams {
+		place(&spec.Teams[i])
+	}
+	return order, nil
+}
+
+
+func strValue(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
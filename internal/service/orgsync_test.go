@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+func TestParseOrgCSV(t *testing.T) {
+	file := `kind,team_name,parent_team,settings,user_id,username,user_role,team_role,weight
+# platform teams
+team,fintech,,reviewers_count=3;sla_policy=reassign,,,,,
+team,payments,fintech,assignment_strategy=least_loaded,,,,,
+member,payments,,,u1,Alice,lead,member,1
+member,payments,,,u2,Bob,,onboarding,
+member,fintech,,,u1,Alice,lead,member,2
+team,empty,,,,,,,
+`
+
+	spec, err := ParseOrgCSV(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("ParseOrgCSV: %v", err)
+	}
+	if len(spec.Teams) != 3 {
+		t.Fatalf("got %d teams, want 3", len(spec.Teams))
+	}
+
+	fintech, payments, empty := spec.Teams[0], spec.Teams[1], spec.Teams[2]
+	if fintech.Name != "fintech" || payments.Name != "payments" || empty.Name != "empty" {
+		t.Fatalf("teams out of file order: %s, %s, %s", fintech.Name, payments.Name, empty.Name)
+	}
+
+	if fintech.ParentTeam != nil {
+		t.Errorf("fintech parent = %q, want none", *fintech.ParentTeam)
+	}
+	if fintech.ReviewersCount != 3 || fintech.SLAPolicy != "reassign" {
+		t.Errorf("fintech settings = %+v", fintech.TeamSettings)
+	}
+	if payments.ParentTeam == nil || *payments.ParentTeam != "fintech" {
+		t.Errorf("payments parent = %v, want fintech", payments.ParentTeam)
+	}
+	if payments.AssignmentStrategy != "least_loaded" {
+		t.Errorf("payments strategy = %q", payments.AssignmentStrategy)
+	}
+
+	if len(payments.Members) != 2 {
+		t.Fatalf("payments has %d members, want 2", len(payments.Members))
+	}
+	alice, bob := payments.Members[0], payments.Members[1]
+	if alice.ID != "u1" || alice.Username != "Alice" || alice.UserRole != entity.UserRoleLead || alice.Weight != 1 || !alice.IsActive {
+		t.Errorf("alice = %+v", alice)
+	}
+	if bob.UserRole != "" || bob.TeamRole != "onboarding" || bob.Weight != 0 {
+		t.Errorf("bob = %+v, want unset role and weight", bob)
+	}
+	if len(fintech.Members) != 1 || fintech.Members[0].Weight != 2 {
+		t.Errorf("fintech members = %+v", fintech.Members)
+	}
+	if empty.Members == nil || len(empty.Members) != 0 {
+		t.Errorf("empty members = %#v, want empty list", empty.Members)
+	}
+}
+
+
+func TestParseOrgCSVErrors(t *testing.T) {
+	const header = "kind,team_name,parent_team,settings,user_id,username,user_role,team_role,weight\n"
+
+	cases := map[string]string{
+		"no header":       "",
+		"no kind column":  "team_name,user_id\nweb,u1\n",
+		"no team column":  "kind,user_id\nteam,u1\n",
+		"empty team name": header + "team,,,,,,,,\n",
+		"duplicate team":  header + "team,web,,,,,,,\nteam,web,,,,,,,\n",
+		"undeclared team": header + "member,web,,,u1,Alice,,,\n",
+		"no user id":      header + "team,web,,,,,,,\nmember,web,,,,Alice,,,\n",
+		"no username":     header + "team,web,,,,,,,\nmember,web,,,u1,,,,\n",
+		"bad weight":      header + "team,web,,,,,,,\nmember,web,,,u1,Alice,,,heavy\n",
+		"duplicate user":  header + "team,web,,,,,,,\nmember,web,,,u1,Alice,,,\nmember,web,,,u1,Alice,,,\n",
+		"unknown kind":    header + "group,web,,,,,,,\n",
+		"bad settings":    header + "team,web,,reviewers=2,,,,,\n",
+		"broken quotes":   header + "team,\"web,,,,,,,\n",
+	}
+
+	for name, file := range cases {
+		if _, err := ParseOrgCSV(strings.NewReader(file)); !errors.Is(err, ErrInvalidOrg) {
+			t.Errorf("%s: err = %v, want ErrInvalidOrg", name, err)
+		}
+	}
+}
+
+
+func TestParseSettings(t *testing.T) {
+	settings, err := parseSettings(" reviewers_count = 2 ; stale_approvals=dismiss;;pool_timeout_minutes=30; ")
+	if err != nil {
+		t.Fatalf("parseSettings: %v", err)
+	}
+	want := entity.TeamSettings{ReviewersCount: 2, StaleApprovals: "dismiss", PoolTimeout: 30}
+	if settings != want {
+		t.Errorf("settings = %+v, want %+v", settings, want)
+	}
+
+	if settings, err := parseSettings(""); err != nil || settings != (entity.TeamSettings{}) {
+		t.Errorf("empty settings = %+v, %v", settings, err)
+	}
+
+	for _, s := range []string{
+		"reviewers=2",
+		"reviewers_count",
+		"reviewers_count=two",
+		"sla_policy=3",
+	} {
+		if _, err := parseSettings(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+func (s *Service) ListPool(ctx context.Context, teamName string) ([]entity.PullRequest, error) {
+	if _, err := s.repo.GetTeam(ctx, teamName); err != nil {
+		return nil, err
+	}
+	return s.repo.ListPool(ctx, teamName)
+}
+
+
+// ClaimPR assigns userID to a pooled PR. The PR row is locked, so concurrent
+// claims of the last free slot are serialized and the loser gets
+// ErrNotPooled. The PR leaves the pool once it has enough reviewers.
+func (s *Service) ClaimPR(ctx context.Context, prID, userID string) (*entity.PullRequest, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkOpen(pr); err != nil {
+		return nil, err
+	}
+
+	if pr.PooledAt == nil {
+		return nil, ErrNotPooled
+	}
+
+	for _, u := range pr.Reviewers {
+		if u.ID == userID {
+			return nil, ErrReviewerFound
+		}
+	}
+
+	if _, err := s.repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	team, err := s.repo.GetTeamTx(ctx, tx, pr.TeamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if team.ArchivedAt != nil {
+		return nil, ErrTeamArchived
+	}
+
+	// Leads may claim too; they are only held back from automatic picks.
+	exclude := map[string]bool{pr.AuthorID: true}
+	candidates := append(filterCandidates(team.Members, exclude), filterLeads(team.Members, exclude)...)
+	if findMember(candidates, userID) == nil {
+		return nil, ErrNotCandidate
+	}
+
+	settings, err := s.settingsFor(ctx, team, pr.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.AddReviewer(ctx, tx, prID, userID, entity.RoleRequired, reviewDeadline(settings, pr.Priority, time.Now())); err != nil {
+		return nil, err
+	}
+
+	if countReviewers(pr.Reviewers)+1 >= settings.ReviewersCount {
+		if err := s.repo.LeavePool(ctx, tx, prID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.BumpPRVersion(ctx, tx, prID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPR(ctx, prID)
+}
+
+
+// AssignExpiredPool falls back to automatic assignment for PRs that stayed
+// in the pool longer than their team's timeout.
+func (s *Service) AssignExpiredPool(ctx context.Context) error {
+	ids, err := s.repo.GetExpiredPoolIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		assigned, err := s.fillFromPool(ctx, id)
+		if err != nil {
+			log.Printf("pool: assignment of PR %s failed: %v", id, err)
+			continue
+		}
+		log.Printf("pool: PR %s was not claimed in time, assigned %v", id, assigned)
+	}
+	return nil
+}
+
+
+func (s *Service) fillFromPool(ctx context.Context, prID string) ([]string, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claimed, closed or archived since the scan.
+	if pr.PooledAt == nil || checkOpen(pr) != nil {
+		return []string{}, nil
+	}
+
+	team, err := s.repo.GetTeamTx(ctx, tx, pr.TeamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if team.ArchivedAt != nil {
+		return []string{}, nil
+	}
+
+	settings, err := s.settingsFor(ctx, team, pr.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := map[string]bool{pr.AuthorID: true}
+	for _, u := range pr.Reviewers {
+		exclude[u.ID] = true
+	}
+
+	// The same selection as for a new PR, including the escalation to parent
+	// teams and leads.
+	candidates, err := s.pickCandidates(ctx, tx, team, exclude, strategyFor(settings, pr.Priority))
+	if err != nil {
+		return nil, err
+	}
+
+	limit := settings.ReviewersCount - countReviewers(pr.Reviewers)
+	if len(candidates) < limit {
+		limit = len(candidates)
+	}
+
+	chosen := make([]string, 0, limit)
+	for i := 0; i < limit; i++ {
+		chosen = append(chosen, candidates[i].ID)
+	}
+
+	if len(chosen) > 0 {
+		if err := s.repo.SaveReviewers(ctx, tx, prID, chosen, reviewDeadline(settings, pr.Priority, time.Now())); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.LeavePool(ctx, tx, prID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.BumpPRVersion(ctx, tx, prID); err != nil {
+		return nil, err
+	}
+
+	return chosen, tx.Commit()
+}
@@ -0,0 +1,333 @@
+package service
+
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+func owesReview(state string) bool {
+	return state == entity.ReviewPending || state == entity.ReviewStale
+}
+
+
+// SubmitReview records the reviewer's verdict. Approvals are tied to sha, or
+// to the current head commit when sha is empty.
+func (s *Service) SubmitReview(ctx context.Context, prID, userID, state, sha string) (*entity.PullRequest, error) {
+	switch state {
+	case entity.ReviewCommented, entity.ReviewApproved, entity.ReviewChangesRequested:
+	default:
+		return nil, ErrInvalidState
+	}
+
+	pr, err := s.repo.GetPR(ctx, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkOpen(pr); err != nil {
+		return nil, err
+	}
+
+	isAssigned := false
+	for _, u := range pr.Reviewers {
+		if u.ID == userID {
+			isAssigned = true
+		}
+	}
+	if !isAssigned {
+		return nil, ErrNotAssigned
+	}
+
+	var approvedSHA *string
+	if state == entity.ReviewApproved {
+		if sha == "" {
+			sha = pr.HeadSHA
+		}
+		approvedSHA = &sha
+	}
+
+	if err := s.repo.SetReviewState(ctx, prID, userID, state, approvedSHA); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPR(ctx, prID)
+}
+
+
+// AddReviewer assigns userID to the PR with the given role on top of the
+// reviewers picked automatically.
+func (s *Service) AddReviewer(ctx context.Context, prID, userID, role string) (*entity.PullRequest, error) {
+	if role == "" {
+		role = entity.RoleOptional
+	}
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkOpen(pr); err != nil {
+		return nil, err
+	}
+
+	for _, u := range pr.Reviewers {
+		if u.ID == userID {
+			return nil, ErrReviewerFound
+		}
+	}
+
+	if _, err := s.repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	team, err := s.repo.GetTeam(ctx, pr.TeamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if team.ArchivedAt != nil {
+		return nil, ErrTeamArchived
+	}
+
+	member := findMember(team.Members, userID)
+	if member == nil || !member.IsActive || member.UserRole == entity.UserRoleBot || userID == pr.AuthorID {
+		return nil, ErrNotCandidate
+	}
+
+	var due entity.ReviewDeadline
+	if role == entity.RoleRequired {
+		settings, err := s.settingsFor(ctx, team, pr.Repository)
+		if err != nil {
+			return nil, err
+		}
+		due = reviewDeadline(settings, pr.Priority, time.Now())
+	}
+
+	if err := s.repo.AddReviewer(ctx, tx, prID, userID, role, due); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.BumpPRVersion(ctx, tx, prID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPR(ctx, prID)
+}
+
+
+// PushCommit records a new head commit and starts a new review round.
+// Reviewers who commented or requested changes owe a review again; approvals
+// are marked stale unless the team keeps them across pushes. It returns the
+// reviewers that were sent back to review.
+func (s *Service) PushCommit(ctx context.Context, prID, sha string) (*entity.PullRequest, []string, error) {
+	if sha == "" {
+		return nil, nil, ErrInvalidPR
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkOpen(pr); err != nil {
+		return nil, nil, err
+	}
+
+	if pr.HeadSHA == sha {
+		return pr, []string{}, nil
+	}
+
+	team, err := s.repo.GetTeam(ctx, pr.TeamName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, err := s.settingsFor(ctx, team, pr.Repository)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.repo.SetHeadSHA(ctx, tx, prID, sha); err != nil {
+		return nil, nil, err
+	}
+
+	due := reviewDeadline(settings, pr.Priority, time.Now())
+
+	reset, err := s.repo.ResetReviews(ctx, tx, prID,
+		[]string{entity.ReviewCommented, entity.ReviewChangesRequested}, entity.ReviewPending, due)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if settings.StaleApprovals == entity.StaleApprovalsDismiss {
+		stale, err := s.repo.ResetReviews(ctx, tx, prID,
+			[]string{entity.ReviewApproved}, entity.ReviewStale, due)
+		if err != nil {
+			return nil, nil, err
+		}
+		reset = append(reset, stale...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	if reset == nil {
+		reset = []string{}
+	}
+
+	updatedPR, err := s.repo.GetPR(ctx, prID)
+	return updatedPR, reset, err
+}
+
+
+// MergePR merges an open PR once it has the approvals its team requires.
+// With the dismiss policy, only approvals of the current head commit count.
+// Merging an already merged PR returns it unchanged.
+func (s *Service) MergePR(ctx context.Context, prID string) (*entity.PullRequest, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.mergeTx(ctx, tx, prID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPR(ctx, prID)
+}
+
+
+func (s *Service) mergeTx(ctx context.Context, tx *sqlx.Tx, prID string) error {
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return err
+	}
+
+	switch pr.Status {
+	case "MERGED":
+		return nil
+	case "CLOSED":
+		return ErrPRClosed
+	}
+
+	team, err := s.repo.GetTeam(ctx, pr.TeamName)
+	if err != nil {
+		return err
+	}
+
+	settings, err := s.settingsFor(ctx, team, pr.Repository)
+	if err != nil {
+		return err
+	}
+
+	if settings.RequiredApprovals > 0 {
+		assignments, err := s.repo.GetReviewAssignments(ctx, tx, prID)
+		if err != nil {
+			return err
+		}
+
+		if countApprovals(assignments, pr.HeadSHA, settings) < settings.RequiredApprovals {
+			return ErrNotApproved
+		}
+	}
+
+	return s.repo.MergePR(ctx, tx, prID)
+}
+
+
+// ClosePR closes an open PR without merging it. Closing an already closed
+// PR returns it unchanged.
+func (s *Service) ClosePR(ctx context.Context, prID string) (*entity.PullRequest, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.closeTx(ctx, tx, prID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPR(ctx, prID)
+}
+
+
+func (s *Service) closeTx(ctx context.Context, tx *sqlx.Tx, prID string) error {
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return err
+	}
+
+	switch pr.Status {
+	case "CLOSED":
+		return nil
+	case "MERGED":
+		return ErrPRMerged
+	}
+
+	return s.repo.ClosePR(ctx, tx, prID)
+}
+
+
+func checkOpen(pr *entity.PullRequest) error {
+	switch pr.Status {
+	case "MERGED":
+		return ErrPRMerged
+	case "CLOSED":
+		return ErrPRClosed
+	}
+	return nil
+}
+
+
+func countApprovals(assignments []entity.PRReviewerPair, headSHA string, settings entity.TeamSettings) int {
+	approvals := 0
+	for _, a := range assignments {
+		if a.State != entity.ReviewApproved || a.Role == entity.RoleShadow {
+			continue
+		}
+		if settings.StaleApprovals == entity.StaleApprovalsDismiss && (a.ApprovedSHA == nil || *a.ApprovedSHA != headSHA) {
+			continue
+		}
+		approvals++
+	}
+	return approvals
+}
@@ -0,0 +1,250 @@
+package service
+
+
+import (
+	"context"
+	"errors"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+
+// The methods below back SCIM provisioning, where the identity provider
+// manages users and teams by ID. Deactivation goes through SetUserActive.
+
+
+func (s *Service) ListUsers(ctx context.Context) ([]entity.User, error) {
+	return s.repo.ListUsers(ctx)
+}
+
+
+// CreateUser adds a user that belongs to no team yet.
+func (s *Service) CreateUser(ctx context.Context, user entity.User) (*entity.User, error) {
+	if user.ID == "" {
+		return nil, ErrInvalidUser
+	}
+	if user.Username == "" {
+		user.Username = user.ID
+	}
+	if user.UserRole == "" {
+		user.UserRole = entity.UserRoleMember
+	}
+	if !validUserRole(user.UserRole) {
+		return nil, ErrInvalidUserRole
+	}
+
+	if err := s.repo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return s.repo.GetUser(ctx, user.ID)
+}
+
+
+// FindUsersByUsername lists the users with the given username, ignoring case.
+func (s *Service) FindUsersByUsername(ctx context.Context, username string) ([]entity.User, error) {
+	return s.repo.FindUsersByUsername(ctx, username)
+}
+
+
+// UserChange holds the user attributes to update; nil fields stay as they are.
+type UserChange struct {
+	Username	*string
+	IsActive	*bool
+}
+
+
+// UpdateUser applies the change in one transaction. Deactivation hands the
+// user's open reviews to others.
+func (s *Service) UpdateUser(ctx context.Context, userID string, change UserChange) (*entity.User, error) {
+	if change.Username != nil && *change.Username == "" {
+		return nil, ErrInvalidUser
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.repo.LockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if change.Username != nil && *change.Username != user.Username {
+		if err := s.repo.SetUsername(ctx, tx, userID, *change.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	if change.IsActive != nil && *change.IsActive != user.IsActive {
+		if _, _, err := s.setUserActive(ctx, tx, userID, *change.IsActive, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUser(ctx, userID)
+}
+
+
+func (s *Service) ListTeams(ctx context.Context) ([]entity.Team, error) {
+	names, err := s.repo.ListTeamNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.getTeams(ctx, names)
+}
+
+
+// FindTeams lists the teams with the given name, ignoring case.
+func (s *Service) FindTeams(ctx context.Context, name string) ([]entity.Team, error) {
+	names, err := s.repo.FindTeamNames(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.getTeams(ctx, names)
+}
+
+
+func (s *Service) getTeams(ctx context.Context, names []string) ([]entity.Team, error) {
+	teams := make([]entity.Team, 0, len(names))
+	for _, name := range names {
+		team, err := s.repo.GetTeam(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, *team)
+	}
+	return teams, nil
+}
+
+
+// CreateTeamWithUsers creates a team with default settings whose members are
+// existing users, left as they are.
+func (s *Service) CreateTeamWithUsers(ctx context.Context, name string, userIDs []string) (*entity.Team, error) {
+	if name == "" {
+		return nil, ErrInvalidTeam
+	}
+
+	users, err := s.existingUsers(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	team := entity.Team{Name: name, Members: make([]entity.TeamMember, 0, len(users))}
+	for _, u := range users {
+		team.Members = append(team.Members, entity.TeamMember{User: u})
+	}
+
+	if err := s.CreateTeam(ctx, team, false); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTeam(ctx, name)
+}
+
+
+// ChangeTeamMembers adds and removes existing users in one transaction. New
+// members join as regular members; removed members keep their open reviews.
+// Adding a member twice or removing a non-member is not an error.
+func (s *Service) ChangeTeamMembers(ctx context.Context, name string, add, remove []string) (*entity.Team, error) {
+	if _, err := s.repo.GetTeam(ctx, name); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.existingUsers(ctx, add); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	for _, id := range add {
+		if err := s.repo.AddMembership(ctx, tx, name, id); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range remove {
+		err := s.repo.RemoveTeamMember(ctx, tx, name, id)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetTeam(ctx, name)
+}
+
+
+// DisbandTeam ends all memberships of the team and deletes it. Teams with
+// open PRs cannot be disbanded.
+func (s *Service) DisbandTeam(ctx context.Context, name string) error {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, openPRs, err := s.repo.LockTeam(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+	if openPRs > 0 {
+		return ErrTeamInUse
+	}
+
+	if err := s.repo.RemoveAllMembers(ctx, tx, name); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteTeam(ctx, tx, name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+
+// existingUsers loads the given users; unknown IDs yield ErrNotFound and
+// departed users ErrUserDeparted.
+func (s *Service) existingUsers(ctx context.Context, ids []string) ([]entity.User, error) {
+	if len(ids) == 0 {
+		return []entity.User{}, nil
+	}
+
+	users, err := s.repo.GetUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(users))
+	for _, u := range users {
+		if u.DepartedAt != nil {
+			return nil, ErrUserDeparted
+		}
+		found[u.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, storage.ErrNotFound
+		}
+	}
+	return users, nil
+}
@@ -4,69 +4,527 @@ package service
 import (
 	"context"
 	"errors"
-	"math/rand"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/storage"
 )
 
 
 var (
-	ErrPRMerged      = errors.New("canot edit merged PR")
-	ErrNotAssigned   = errors.New("user is not a reviewer")
-	ErrNoCandidates  = errors.New("no candidates")
-	ErrReviewerFound = errors.New("reviewer already assigned")
+	ErrPRMerged        = errors.New("canot edit merged PR")
+	ErrPRClosed        = errors.New("cannot edit closed PR")
+	ErrNotAssigned     = errors.New("user is not a reviewer")
+	ErrNoCandidates    = errors.New("no candidates")
+	ErrReviewerFound   = errors.New("reviewer already assigned")
+	ErrNotCandidate    = errors.New("user is not a valid candidate")
+	ErrInvalidReason   = errors.New("invalid reassignment reason")
+	ErrInvalidState    = errors.New("invalid review state")
+	ErrInvalidSettings = errors.New("invalid team settings")
+	ErrInvalidPR       = errors.New("invalid pull request")
+	ErrVersionConflict = errors.New("pull request version conflict")
+	ErrNotApproved     = errors.New("not enough approvals")
+	ErrUndoExpired     = errors.New("undo window has expired")
+	ErrUndoUnavailable = errors.New("nothing to undo")
+	ErrInvalidFilter   = errors.New("invalid list filter")
+	ErrDeclineLimit    = errors.New("daily decline limit reached")
+	ErrNotPooled       = errors.New("pull request is not in the pool")
+	ErrInvalidRole     = errors.New("invalid reviewer role")
+	ErrInvalidTeam     = errors.New("invalid team")
+	ErrTeamArchived    = errors.New("team is archived")
+	ErrTeamInUse       = errors.New("team still has members or open pull requests")
+	ErrNotMember       = errors.New("user is not a member of the team")
+	ErrInvalidUserRole = errors.New("invalid user role")
+	ErrUserDeparted    = errors.New("user has departed")
+	ErrInvalidUser     = errors.New("invalid user")
 )
 
 
+// VersionConflictError is returned when the client-supplied PR version is stale.
+type VersionConflictError struct {
+	Current int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%v: current version is %d", ErrVersionConflict, e.Current)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+
+const defaultReviewersCount = 2
+
+
+var reassignReasons = map[string]bool{
+	entity.ReasonUnavailable:  true,
+	entity.ReasonLacksContext: true,
+	entity.ReasonConflict:     true,
+	entity.ReasonWorkload:     true,
+	entity.ReasonOther:        true,
+}
+
+
 type Repository interface {
 	BeginTx(ctx context.Context) (*sqlx.Tx, error)
 
-	CreateTeam(ctx context.Context, team entity.Team) error
+	CreateTeam(ctx context.Context, tx *sqlx.Tx, team entity.Team) error
 	GetTeam(ctx context.Context, name string) (*entity.Team, error)
-	GetTeamMembers(ctx context.Context, teamName string) ([]entity.User, error)
+	GetTeamTx(ctx context.Context, tx *sqlx.Tx, name string) (*entity.Team, error)
+	UpdateTeamSettings(ctx context.Context, team entity.Team) error
+	SaveRepositorySettings(ctx context.Context, rs entity.RepositorySettings) error
+	GetRepositorySettings(ctx context.Context, teamName, repository string) (*entity.RepositorySettings, error)
+	GetTeamMembers(ctx context.Context, teamName string) ([]entity.TeamMember, error)
 	GetUser(ctx context.Context, userID string) (*entity.User, error)
-	SetUserActive(ctx context.Context, userID string, isActive bool) error
-	GetUserReviews(ctx context.Context, userID string) ([]entity.PullRequest, error)
+	GetUsers(ctx context.Context, ids []string) ([]entity.User, error)
+	MoveMembership(ctx context.Context, tx *sqlx.Tx, userID, from, to string) error
+	RemoveMemberships(ctx context.Context, tx *sqlx.Tx, userID, keepTeam string) ([]string, error)
+	UpdateMember(ctx context.Context, m entity.TeamMember) error
+	MoveAuthoredPRs(ctx context.Context, tx *sqlx.Tx, userID, from, to string) ([]string, error)
+	SaveTransfer(ctx context.Context, tx *sqlx.Tx, t *entity.TeamTransfer) error
+	GetTransfers(ctx context.Context, userID string) ([]entity.TeamTransfer, error)
+	LockUser(ctx context.Context, tx *sqlx.Tx, userID string) error
+	LockUsers(ctx context.Context, tx *sqlx.Tx, ids []string) ([]string, error)
+	LockActiveUsers(ctx context.Context, tx *sqlx.Tx, ids []string) ([]string, error)
+	SetUserActive(ctx context.Context, tx *sqlx.Tx, userID string, isActive bool) error
+	SetUserRole(ctx context.Context, userID, role string) error
+	ListUsers(ctx context.Context) ([]entity.User, error)
+	FindUsersByUsername(ctx context.Context, username string) ([]entity.User, error)
+	CreateUser(ctx context.Context, user entity.User) error
+	SetUsername(ctx context.Context, tx *sqlx.Tx, userID, username string) error
+	EnsureUser(ctx context.Context, tx *sqlx.Tx, user entity.User) (bool, error)
+	GetGitHubLogins(ctx context.Context) (map[string]string, error)
+	SetGitHubLogin(ctx context.Context, tx *sqlx.Tx, login, userID string) error
+	AddMembership(ctx context.Context, tx *sqlx.Tx, teamName, userID string) error
+	RemoveAllMembers(ctx context.Context, tx *sqlx.Tx, teamName string) error
+	MarkDeparted(ctx context.Context, tx *sqlx.Tx, userID string) error
+	GetAnonymizableIDs(ctx context.Context, departedBefore time.Time) ([]string, error)
+	AnonymizeUser(ctx context.Context, tx *sqlx.Tx, userID, pseudonym string) error
+	AddTeamMembers(ctx context.Context, tx *sqlx.Tx, teamName string, members []entity.TeamMember) error
+	RemoveTeamMember(ctx context.Context, tx *sqlx.Tx, teamName, userID string) error
+	RenameTeam(ctx context.Context, oldName, newName string) error
+	SetTeamArchived(ctx context.Context, name string, archived bool) error
+	SetTeamParent(ctx context.Context, tx *sqlx.Tx, name string, parent *string) error
+	ListTeamNames(ctx context.Context) ([]string, error)
+	FindTeamNames(ctx context.Context, name string) ([]string, error)
+	LockOrg(ctx context.Context, tx *sqlx.Tx) error
+	UpsertTeam(ctx context.Context, tx *sqlx.Tx, team entity.Team) error
+	ArchiveTeams(ctx context.Context, tx *sqlx.Tx, names []string) error
+	GetTeamAncestors(ctx context.Context, name string) ([]string, error)
+	GetTeamAncestorsTx(ctx context.Context, tx *sqlx.Tx, name string) ([]string, error)
+	LockTeamAncestors(ctx context.Context, tx *sqlx.Tx, name string) ([]string, error)
+	LockTeams(ctx context.Context, tx *sqlx.Tx, names ...string) error
+	GetTeamDescendants(ctx context.Context, name string) ([]string, error)
+	LockTeam(ctx context.Context, tx *sqlx.Tx, name string) (members, openPRs int, err error)
+	MoveTeamMembers(ctx context.Context, tx *sqlx.Tx, from, to string) ([]string, []string, error)
+	DeleteTeam(ctx context.Context, tx *sqlx.Tx, name string) error
+	GetOpenReviewIDs(ctx context.Context, tx *sqlx.Tx, userID, teamName string) ([]string, error)
+	GetUserReviews(ctx context.Context, userID string) ([]entity.UserReview, error)
+	GetReviewLoad(ctx context.Context, userIDs []string) ([]entity.ReviewLoad, error)
+	GetReviewLoadTx(ctx context.Context, tx *sqlx.Tx, userIDs []string) ([]entity.ReviewLoad, error)
+	CountDeclines(ctx context.Context, tx *sqlx.Tx, userID string, since time.Time) (int, error)
+	GetReviewerStats(ctx context.Context, userID string, since time.Time) (*entity.ReviewerStats, error)
 
 	SavePR(ctx context.Context, tx *sqlx.Tx, pr entity.PullRequest) error
-	SaveReviewers(ctx context.Context, tx *sqlx.Tx, prID string, reviewerIDs []string) error
+	SaveReviewers(ctx context.Context, tx *sqlx.Tx, prID string, reviewerIDs []string, due entity.ReviewDeadline) error
 	GetPR(ctx context.Context, prID string) (*entity.PullRequest, error)
-	MergePR(ctx context.Context, prID string) (*entity.PullRequest, error)
+	ListPRs(ctx context.Context, f entity.PRFilter) ([]entity.PullRequest, error)
+	GetStack(ctx context.Context, prID string) ([]entity.PullRequest, error)
+	GetDescendantIDs(ctx context.Context, tx *sqlx.Tx, prID string) ([]string, error)
+	LockPR(ctx context.Context, tx *sqlx.Tx, prID string) (*entity.PullRequest, error)
+	MergePR(ctx context.Context, tx *sqlx.Tx, prID string) error
+	ClosePR(ctx context.Context, tx *sqlx.Tx, prID string) error
+	SetHeadSHA(ctx context.Context, tx *sqlx.Tx, prID, sha string) error
+	UpdatePR(ctx context.Context, tx *sqlx.Tx, pr entity.PullRequest) error
+	BumpPRVersion(ctx context.Context, tx *sqlx.Tx, prID string) error
 	
 	RemoveReviewer(ctx context.Context, tx *sqlx.Tx, prID, userID string) error
-	AddReviewer(ctx context.Context, tx *sqlx.Tx, prID, userID string) error
+	AddReviewer(ctx context.Context, tx *sqlx.Tx, prID, userID, role string, due entity.ReviewDeadline) error
+
+	SaveReassignment(ctx context.Context, tx *sqlx.Tx, r *entity.Reassignment) error
+	GetReassignments(ctx context.Context, prID string) ([]entity.Reassignment, error)
+	GetLastReassignment(ctx context.Context, tx *sqlx.Tx, prID string) (*entity.Reassignment, error)
+	MarkReassignmentUndone(ctx context.Context, tx *sqlx.Tx, id int64) error
+	RestoreReviewer(ctx context.Context, tx *sqlx.Tx, a entity.PRReviewerPair) error
+
+	SetReviewState(ctx context.Context, prID, userID, state string, approvedSHA *string) error
+	GetReviewAssignments(ctx context.Context, tx *sqlx.Tx, prID string) ([]entity.PRReviewerPair, error)
+	ResetReviews(ctx context.Context, tx *sqlx.Tx, prID string, states []string, newState string, due entity.ReviewDeadline) ([]string, error)
+	GetOverdueReviews(ctx context.Context) ([]entity.OverdueReview, error)
+	MarkEscalated(ctx context.Context, prID, userID string) error
+	ListPool(ctx context.Context, teamName string) ([]entity.PullRequest, error)
+	LeavePool(ctx context.Context, tx *sqlx.Tx, prID string) error
+	GetExpiredPoolIDs(ctx context.Context) ([]string, error)
+}
+
+
+type ReassignInput struct {
+	PRID      string
+	OldUserID string
+	NewUserID string
+	Reason    string
+	Comment   string
+
+	// Propagate repeats the replacement on every PR stacked on top of PRID.
+	Propagate bool
+
+	// Declined marks a replacement requested by the reviewer themselves.
+	Declined bool
+}
+
+
+type ReassignResult struct {
+	PR         *entity.PullRequest
+	ReplacedBy string
+	Propagated []entity.Reassignment
+}
+
+
+// PRUpdate holds a partial PR update; nil fields are left unchanged.
+type PRUpdate struct {
+	Name         *string
+	SourceBranch *string
+	TargetBranch *string
+	URL          *string
+	Labels       []string
+	Priority     *string
+}
+
+
+type Config struct {
+	// UndoWindow is how long after a reassignment it can still be undone.
+	UndoWindow time.Duration
+
+	// DeclineDailyLimit caps how many reviews a user may decline within
+	// 24 hours. Zero disables the limit.
+	DeclineDailyLimit int
+
+	// TransferReviewPolicy and TransferPRPolicy are applied to /users/transfer
+	// calls that do not choose a policy.
+	TransferReviewPolicy string
+	TransferPRPolicy     string
+
+	// BotPRPolicy decides how PRs authored by bots get reviewers: as usual,
+	// through the team pool or not at all. BotPRTeam, when set, is the team
+	// that owns every bot PR.
+	BotPRPolicy string
+	BotPRTeam   string
+
+	// AnonymizeAfter is how long offboarded users keep their personal data.
+	// Zero disables anonymization.
+	AnonymizeAfter time.Duration
+
+	// GitHub is where ImportGitHubOrg reads teams from. Nil disables the
+	// import.
+	GitHub GitHubSource
 }
 
 
 type Service struct {
 	repo Repository
+	cfg  Config
+}
+
+
+func New(repo Repository, cfg Config) *Service {
+	return &Service{repo: repo, cfg: cfg}
+}
+
+// CreateTeam creates the team with its members. Users keep their other
+// teams unless moveMembers is set; each such move is recorded in the transfer
+// history.
+func (s *Service) CreateTeam(ctx context.Context, team entity.Team, moveMembers bool) error {
+	if err := normalizeSettings(&team.TeamSettings); err != nil {
+		return err
+	}
+	if err := normalizeMembers(team.Members); err != nil {
+		return err
+	}
+	if err := s.rejectDeparted(ctx, team.Members); err != nil {
+		return err
+	}
+
+	if team.ParentTeam != nil && *team.ParentTeam == "" {
+		team.ParentTeam = nil
+	}
+	if team.ParentTeam != nil {
+		if _, err := s.repo.GetTeam(ctx, *team.ParentTeam); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	moved, err := s.movedMembers(ctx, tx, team.Name, team.Members, moveMembers)
+	if err != nil {
+		return err
+	}
+
+	deactivated, err := s.repo.LockActiveUsers(ctx, tx, inactiveIDs(team.Members))
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.CreateTeam(ctx, tx, team); err != nil {
+		return err
+	}
+
+	if err := s.reassignDeactivated(ctx, tx, deactivated); err != nil {
+		return err
+	}
+
+	if err := s.recordMoves(ctx, tx, team.Name, moved); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Service) UpdateTeamSettings(ctx context.Context, name string, settings entity.TeamSettings) (*entity.Team, error) {
+	if err := normalizeSettings(&settings); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateTeamSettings(ctx, entity.Team{Name: name, TeamSettings: settings}); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTeam(ctx, name)
+}
+
+func (s *Service) SaveRepositorySettings(ctx context.Context, rs entity.RepositorySettings) (*entity.Team, error) {
+	if rs.Repository == "" {
+		return nil, ErrInvalidSettings
+	}
+	if rs.ReviewersCount != nil && *rs.ReviewersCount < 0 {
+		return nil, ErrInvalidSettings
+	}
+	if rs.Strategy != nil && !validStrategy(*rs.Strategy) {
+		return nil, ErrInvalidSettings
+	}
+
+	if err := s.repo.SaveRepositorySettings(ctx, rs); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTeam(ctx, rs.TeamName)
+}
+
+
+// settingsFor returns the team settings with the overrides for repository applied.
+func (s *Service) settingsFor(ctx context.Context, team *entity.Team, repository string) (entity.TeamSettings, error) {
+	settings := team.TeamSettings
+	if repository == "" {
+		return settings, nil
+	}
+
+	rs, err := s.repo.GetRepositorySettings(ctx, team.Name, repository)
+	if errors.Is(err, storage.ErrNotFound) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+
+	if rs.ReviewersCount != nil {
+		settings.ReviewersCount = *rs.ReviewersCount
+	}
+	if rs.Strategy != nil {
+		settings.AssignmentStrategy = *rs.Strategy
+	}
+	return settings, nil
+}
+
+
+func normalizeSettings(settings *entity.TeamSettings) error {
+	if settings.SLAPolicy == "" {
+		settings.SLAPolicy = entity.SLAPolicyNotify
+	}
+
+	switch settings.SLAPolicy {
+	case entity.SLAPolicyNotify, entity.SLAPolicyAddReviewer, entity.SLAPolicyReassign:
+	default:
+		return ErrInvalidSettings
+	}
+
+	if settings.FirstResponseSLA < 0 || settings.VerdictSLA < 0 {
+		return ErrInvalidSettings
+	}
+
+	if settings.ReviewersCount == 0 {
+		settings.ReviewersCount = defaultReviewersCount
+	}
+	if settings.ReviewersCount < 0 || settings.RequiredApprovals < 0 {
+		return ErrInvalidSettings
+	}
+
+	if settings.StaleApprovals == "" {
+		settings.StaleApprovals = entity.StaleApprovalsDismiss
+	}
+	if settings.StaleApprovals != entity.StaleApprovalsDismiss && settings.StaleApprovals != entity.StaleApprovalsKeep {
+		return ErrInvalidSettings
+	}
+
+	if settings.AssignmentStrategy == "" {
+		settings.AssignmentStrategy = entity.StrategyRandom
+	}
+	if !validStrategy(settings.AssignmentStrategy) {
+		return ErrInvalidSettings
+	}
+
+	if settings.AssignmentMode == "" {
+		settings.AssignmentMode = entity.ModeAuto
+	}
+	if settings.AssignmentMode != entity.ModeAuto && settings.AssignmentMode != entity.ModePool {
+		return ErrInvalidSettings
+	}
+	if settings.PoolTimeout < 0 {
+		return ErrInvalidSettings
+	}
+
+	if settings.ShadowShare < 0 || settings.ShadowShare > 100 {
+		return ErrInvalidSettings
+	}
+	return nil
 }
 
 
-func New(repo Repository) *Service {
-	return &Service{repo: repo}
+// SetUserActive updates the flag and, when deactivating with reassignReviews,
+// hands every open review of the user to someone else in the same transaction.
+// PRs without a replacement candidate are returned in the second slice.
+func (s *Service) SetUserActive(ctx context.Context, userID string, isActive, reassignReviews bool) ([]entity.Reassignment, []string, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	reassigned, skipped, err := s.setUserActive(ctx, tx, userID, isActive, reassignReviews)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return reassigned, skipped, nil
+}
+
+
+func (s *Service) setUserActive(ctx context.Context, tx *sqlx.Tx, userID string, isActive, reassignReviews bool) ([]entity.Reassignment, []string, error) {
+	if isActive {
+		user, err := s.repo.GetUser(ctx, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if user.DepartedAt != nil {
+			return nil, nil, ErrUserDeparted
+		}
+	}
+
+	if err := s.repo.SetUserActive(ctx, tx, userID, isActive); err != nil {
+		return nil, nil, err
+	}
+
+	reassigned := make([]entity.Reassignment, 0)
+	skipped := make([]string, 0)
+
+	if !isActive && reassignReviews {
+		var err error
+		if reassigned, skipped, err = s.reassignAll(ctx, tx, userID, "", entity.ReasonDeactivated); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return reassigned, skipped, nil
 }
 
-func (s *Service) CreateTeam(ctx context.Context, team entity.Team) error {
-	return s.repo.CreateTeam(ctx, team)
+
+// reassignDeactivated hands the open reviews of users that a team upsert has
+// just deactivated to someone else, as /users/setIsActive does.
+func (s *Service) reassignDeactivated(ctx context.Context, tx *sqlx.Tx, userIDs []string) error {
+	for _, id := range userIDs {
+		if _, _, err := s.reassignAll(ctx, tx, id, "", entity.ReasonDeactivated); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *Service) SetUserActive(ctx context.Context, userID string, isActive bool) error {
-	return s.repo.SetUserActive(ctx, userID, isActive)
+
+// inactiveIDs returns the IDs of the members marked inactive.
+func inactiveIDs(members []entity.TeamMember) []string {
+	ids := make([]string, 0)
+	for _, m := range members {
+		if !m.IsActive {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+
+// reassignAll hands the open reviews of userID on PRs of teamName, or on all
+// PRs when teamName is empty, to someone else inside tx. PRs without a
+// replacement candidate are returned in the second slice.
+func (s *Service) reassignAll(ctx context.Context, tx *sqlx.Tx, userID, teamName, reason string) ([]entity.Reassignment, []string, error) {
+	reassigned := make([]entity.Reassignment, 0)
+	skipped := make([]string, 0)
+
+	prIDs, err := s.repo.GetOpenReviewIDs(ctx, tx, userID, teamName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, prID := range prIDs {
+		record, err := s.reassignTx(ctx, tx, ReassignInput{
+			PRID:      prID,
+			OldUserID: userID,
+			Reason:    reason,
+		})
+		if errors.Is(err, ErrNoCandidates) {
+			skipped = append(skipped, prID)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		reassigned = append(reassigned, *record)
+	}
+
+	return reassigned, skipped, nil
 }
 
 func (s *Service) GetTeam(ctx context.Context, name string) (*entity.Team, error) {
 	return s.repo.GetTeam(ctx, name)
 }
 
-func (s *Service) GetUserReviews(ctx context.Context, userID string) ([]entity.PullRequest, error) {
-	return s.repo.GetUserReviews(ctx, userID)
+func (s *Service) GetUserReviews(ctx context.Context, userID string) ([]entity.UserReview, error) {
+	reviews, err := s.repo.GetUserReviews(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range reviews {
+		reviews[i].OwesReview = reviews[i].Status == "OPEN" && reviews[i].ReviewRole != entity.RoleShadow &&
+			owesReview(reviews[i].ReviewState)
+	}
+	return reviews, nil
 }
 
-func (s *Service) MergePR(ctx context.Context, prID string) (*entity.PullRequest, error) {
-	return s.repo.MergePR(ctx, prID)
+
+func (s *Service) GetPR(ctx context.Context, prID string) (*entity.PullRequest, error) {
+	return s.repo.GetPR(ctx, prID)
 }
 
 
@@ -75,48 +533,173 @@ func (s *Service) GetUser(ctx context.Context, userID string) (*entity.User, err
 }
 
 
-func (s *Service) CreatePR(ctx context.Context, reqID, name, authorID string) (*entity.PullRequest, error) {
-	author, err := s.repo.GetUser(ctx, authorID)
+// RepositoryPRID is the ID of PR number in repository, so that the same
+// number in two repositories never collides.
+func RepositoryPRID(repository string, number int) string {
+	return fmt.Sprintf("%s#%d", repository, number)
+}
+
+
+func (s *Service) SetUserRole(ctx context.Context, userID, role string) (*entity.User, error) {
+	if !validUserRole(role) {
+		return nil, ErrInvalidUserRole
+	}
+
+	if err := s.repo.SetUserRole(ctx, userID, role); err != nil {
+		return nil, err
+	}
+	return s.repo.GetUser(ctx, userID)
+}
+
+
+// CanManageTeam reports whether the user may perform admin actions on the
+// team: rename, archive, delete and membership changes. Only leads of the
+// team or of one of its parent teams may. It is meant for the authentication
+// layer; endpoints do not check it yet.
+func (s *Service) CanManageTeam(ctx context.Context, userID, teamName string) (bool, error) {
+	user, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if !user.IsActive || user.UserRole != entity.UserRoleLead {
+		return false, nil
+	}
+
+	ancestors, err := s.repo.GetTeamAncestors(ctx, teamName)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range append([]string{teamName}, ancestors...) {
+		if contains(user.Teams, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+
+// UpdateMember changes the role and weight of a team membership.
+func (s *Service) UpdateMember(ctx context.Context, m entity.TeamMember) (*entity.Team, error) {
+	members := []entity.TeamMember{m}
+	if err := normalizeMembers(members); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateMember(ctx, members[0]); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTeam(ctx, m.TeamName)
+}
+
+
+// SetUserOnboarding switches the user's membership in teamName, by default
+// their home team, between the member and onboarding roles.
+func (s *Service) SetUserOnboarding(ctx context.Context, userID, teamName string, onboarding bool) (*entity.User, error) {
+	user, err := s.repo.GetUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
+	if teamName == "" {
+		teamName = user.TeamName
+	}
 
-	teamMembers, err := s.repo.GetTeamMembers(ctx, author.TeamName)
+	members, err := s.repo.GetTeamMembers(ctx, teamName)
 	if err != nil {
 		return nil, err
 	}
+	m := findMember(members, userID)
+	if m == nil {
+		return nil, ErrNotMember
+	}
+
+	m.TeamRole = entity.TeamRoleMember
+	if onboarding {
+		m.TeamRole = entity.TeamRoleOnboarding
+	}
+	if _, err := s.UpdateMember(ctx, *m); err != nil {
+		return nil, err
+	}
+	return s.repo.GetUser(ctx, userID)
+}
 
-	candidates := make([]entity.User, 0)
-	for _, u := range teamMembers {
-		if u.IsActive && u.ID != author.ID {
-			candidates = append(candidates, u)
+
+func (s *Service) CreatePR(ctx context.Context, pr entity.PullRequest) (*entity.PullRequest, error) {
+	if (pr.Repository == "") != (pr.Number == nil) {
+		return nil, ErrInvalidPR
+	}
+	if pr.Number != nil && *pr.Number <= 0 {
+		return nil, ErrInvalidPR
+	}
+	// PRs of a repository are identified by repository and number; "#" is
+	// reserved for their IDs.
+	if pr.Number != nil {
+		id := RepositoryPRID(pr.Repository, *pr.Number)
+		if pr.ID != "" && pr.ID != id {
+			return nil, ErrInvalidPR
 		}
+		pr.ID = id
+	} else if strings.Contains(pr.ID, "#") {
+		return nil, ErrInvalidPR
+	}
+	if pr.ID == "" {
+		return nil, ErrInvalidPR
+	}
+	if pr.Labels == nil {
+		pr.Labels = []string{}
+	}
+	if pr.Priority == "" {
+		pr.Priority = entity.PriorityNormal
+	}
+	if !validPriority(pr.Priority) {
+		return nil, ErrInvalidPR
+	}
+
+	author, err := s.repo.GetUser(ctx, pr.AuthorID)
+	if err != nil {
+		return nil, err
 	}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	r.Shuffle(len(candidates), func(i, j int) { 
-		candidates[i], candidates[j] = candidates[j], candidates[i] 
-	})
+	isBot := author.UserRole == entity.UserRoleBot
 
-	limit := 2
-	if len(candidates) < 2 {
-		limit = len(candidates)
+	// Authors in several teams may pick the team; the home team is the
+	// default. Bot PRs go to the configured bot team, if any.
+	if isBot && s.cfg.BotPRTeam != "" {
+		pr.TeamName = s.cfg.BotPRTeam
 	}
-	
-	chosenReviewers := make([]string, 0, limit)
-	choseStructs := make([]entity.User, 0, limit)
-	for i := 0; i < limit; i++ {
-		chosenReviewers = append(chosenReviewers, candidates[i].ID)
-		choseStructs = append(choseStructs, candidates[i])
+	if pr.TeamName == "" {
+		pr.TeamName = author.TeamName
+	}
+
+	team, err := s.repo.GetTeam(ctx, pr.TeamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if findMember(team.Members, author.ID) == nil && !(isBot && s.cfg.BotPRTeam != "") {
+		return nil, ErrNotMember
 	}
 
-	pr := entity.PullRequest{
-		ID:        reqID,
-		Name:      name,
-		AuthorID:  authorID,
-		Status:    "OPEN",
-		CreatedAt: time.Now(),
-		Reviewers: choseStructs,
+	if team.ArchivedAt != nil {
+		return nil, ErrTeamArchived
+	}
+
+	settings, err := s.settingsFor(ctx, team, pr.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *entity.PullRequest
+	if pr.ParentID != nil {
+		if parent, err = s.repo.GetPR(ctx, *pr.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+
+	botPolicy := ""
+	if isBot {
+		botPolicy = s.cfg.BotPRPolicy
 	}
 
 	tx, err := s.repo.BeginTx(ctx)
@@ -126,12 +709,157 @@ func (s *Service) CreatePR(ctx context.Context, reqID, name, authorID string) (*
 
 	defer tx.Rollback()
 
+	// In pool mode reviewers claim the PR themselves; bot PRs may also be
+	// routed to the pool or left without reviewers.
+	chosenReviewers := []string{}
+	shadow := ""
+	switch {
+	case botPolicy == entity.BotPRsNone:
+	case settings.AssignmentMode == entity.ModePool || botPolicy == entity.BotPRsPool:
+		pr.PooledAt = &now
+	default:
+		exclude := map[string]bool{author.ID: true}
+
+		candidates, err := s.pickCandidates(ctx, tx, team, exclude, strategyFor(settings, pr.Priority))
+		if err != nil {
+			return nil, err
+		}
+
+		if parent != nil {
+			candidates = preferReviewers(candidates, parent.Reviewers)
+		}
+
+		limit := settings.ReviewersCount
+		if len(candidates) < limit {
+			limit = len(candidates)
+		}
+
+		for i := 0; i < limit; i++ {
+			chosenReviewers = append(chosenReviewers, candidates[i].ID)
+		}
+	}
+
+	if botPolicy != entity.BotPRsNone {
+		shadow = pickShadow(settings, team.Members, author.ID)
+	}
+
+	pr.Status = "OPEN"
+	pr.Version = 1
+	pr.ReviewRound = 1
+	pr.TeamName = team.Name
+	pr.CreatedAt = now
+
 	if err := s.repo.SavePR(ctx, tx, pr); err != nil {
 		return nil, err
 	}
 
 	if len(chosenReviewers) > 0 {
-		if err := s.repo.SaveReviewers(ctx, tx, pr.ID, chosenReviewers); err != nil {
+		if err := s.repo.SaveReviewers(ctx, tx, pr.ID, chosenReviewers, reviewDeadline(settings, pr.Priority, now)); err != nil {
+			return nil, err
+		}
+	}
+
+	if shadow != "" {
+		if err := s.repo.AddReviewer(ctx, tx, pr.ID, shadow, entity.RoleShadow, entity.ReviewDeadline{}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPR(ctx, pr.ID)
+}
+
+
+// UpdatePR applies upd only if version matches the stored PR version.
+func (s *Service) UpdatePR(ctx context.Context, prID string, version int, upd PRUpdate) (*entity.PullRequest, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return nil, err
+	}
+
+	if pr.Version != version {
+		return nil, &VersionConflictError{Current: pr.Version}
+	}
+
+	if err := checkOpen(pr); err != nil {
+		return nil, err
+	}
+
+	if upd.Name != nil {
+		if *upd.Name == "" {
+			return nil, ErrInvalidPR
+		}
+		pr.Name = *upd.Name
+	}
+	if upd.SourceBranch != nil {
+		pr.SourceBranch = *upd.SourceBranch
+	}
+	if upd.TargetBranch != nil {
+		pr.TargetBranch = *upd.TargetBranch
+	}
+	if upd.URL != nil {
+		pr.URL = *upd.URL
+	}
+	if upd.Labels != nil {
+		pr.Labels = upd.Labels
+	}
+	if upd.Priority != nil {
+		if !validPriority(*upd.Priority) {
+			return nil, ErrInvalidPR
+		}
+		pr.Priority = *upd.Priority
+	}
+
+	if err := s.repo.UpdatePR(ctx, tx, *pr); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetPR(ctx, prID)
+}
+
+
+func (s *Service) ReassignReviewer(ctx context.Context, in ReassignInput) (*ReassignResult, error) {
+	if in.Reason == "" {
+		in.Reason = entity.ReasonOther
+	}
+	if !reassignReasons[in.Reason] {
+		return nil, ErrInvalidReason
+	}
+
+	return s.reassign(ctx, in)
+}
+
+
+func (s *Service) reassign(ctx context.Context, in ReassignInput) (*ReassignResult, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil { 
+		return nil, err 
+	}
+
+	defer tx.Rollback()
+
+	record, err := s.reassignTx(ctx, tx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	propagated := make([]entity.Reassignment, 0)
+	if in.Propagate {
+		if propagated, err = s.propagateReassign(ctx, tx, in, record.NewUserID); err != nil {
 			return nil, err
 		}
 	}
@@ -140,80 +868,239 @@ func (s *Service) CreatePR(ctx context.Context, reqID, name, authorID string) (*
 		return nil, err
 	}
 
-	return &pr, nil
+	updatedPR, err := s.repo.GetPR(ctx, in.PRID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReassignResult{
+		PR:         updatedPR,
+		ReplacedBy: record.NewUserID,
+		Propagated: propagated,
+	}, nil
 }
 
 
-func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string) (*entity.PullRequest, string, error) {
-	pr, err := s.repo.GetPR(ctx, prID)
+// reassignTx replaces a reviewer inside the caller's transaction. Candidate
+// checks fail before anything is written, so the caller may keep using tx
+// after ErrNoCandidates or ErrNotCandidate.
+func (s *Service) reassignTx(ctx context.Context, tx *sqlx.Tx, in ReassignInput) (*entity.Reassignment, error) {
+	pr, err := s.repo.LockPR(ctx, tx, in.PRID)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	if pr.Status == "MERGED" {
-		return nil, "", ErrPRMerged
+	if err := checkOpen(pr); err != nil {
+		return nil, err
 	}
 
 	busyMap := make(map[string]bool)
 	isAssigned := false
+	role := entity.RoleRequired
 
 	for _, u := range pr.Reviewers {
 		busyMap[u.ID] = true
 
-		if u.ID == oldUserID {
+		if u.ID == in.OldUserID {
 			isAssigned = true
+			role = u.Role
 		}
 	}
 	if !isAssigned {
-		return nil, "", ErrNotAssigned
+		return nil, ErrNotAssigned
 	}
 
-	oldUser, err := s.repo.GetUser(ctx, oldUserID)
+	// Read inside tx: a team upsert may have deactivated members in it.
+	team, err := s.repo.GetTeamTx(ctx, tx, pr.TeamName)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+
+	// Archived teams have no candidates.
+	if team.ArchivedAt != nil {
+		return nil, ErrNoCandidates
 	}
 
-	teamMembers, err := s.repo.GetTeamMembers(ctx, oldUser.TeamName)
+	settings, err := s.settingsFor(ctx, team, pr.Repository)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	candidates := make([]entity.User, 0)
-	for _, u := range teamMembers {
-		if !u.IsActive { continue }
-		if u.ID == pr.AuthorID { continue }
-		if busyMap[u.ID] { continue }
+	busyMap[pr.AuthorID] = true
 
-		candidates = append(candidates, u)
+	// The replacement takes over the role; shadows are replaced by other
+	// onboarding members.
+	filter := filterCandidates
+	if role == entity.RoleShadow {
+		filter = filterShadows
 	}
 
+	candidates := filter(team.Members, busyMap)
 	if len(candidates) == 0 {
-		return nil, "", ErrNoCandidates
+		withLeads := role != entity.RoleShadow
+		if candidates, err = s.escalateCandidates(ctx, tx, team.Name, busyMap, filter, withLeads); err != nil {
+			return nil, err
+		}
+	}
+
+	var newReviewer entity.TeamMember
+	if in.NewUserID != "" {
+		found := false
+		for _, u := range candidates {
+			if u.ID == in.NewUserID {
+				newReviewer = u
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrNotCandidate
+		}
+	} else {
+		if len(candidates) == 0 {
+			return nil, ErrNoCandidates
+		}
+
+		ordered, err := s.orderCandidates(ctx, tx, candidates, strategyFor(settings, pr.Priority))
+		if err != nil {
+			return nil, err
+		}
+		newReviewer = ordered[0]
+	}
+
+	assignments, err := s.repo.GetReviewAssignments(ctx, tx, in.PRID)
+	if err != nil {
+		return nil, err
 	}
 
+	var previous *entity.PRReviewerPair
+	for i := range assignments {
+		if assignments[i].UserID == in.OldUserID {
+			previous = &assignments[i]
+		}
+	}
+
+	if err := s.repo.RemoveReviewer(ctx, tx, in.PRID, in.OldUserID); err != nil {
+		return nil, err
+	}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	newReviewer := candidates[r.Intn(len(candidates))]
+	var due entity.ReviewDeadline
+	if role == entity.RoleRequired {
+		due = reviewDeadline(settings, pr.Priority, time.Now())
+	}
 
+	if err := s.repo.AddReviewer(ctx, tx, in.PRID, newReviewer.ID, role, due); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.BumpPRVersion(ctx, tx, in.PRID); err != nil {
+		return nil, err
+	}
+
+	record := &entity.Reassignment{
+		PRID:      in.PRID,
+		OldUserID: in.OldUserID,
+		NewUserID: newReviewer.ID,
+		Reason:    in.Reason,
+		Comment:   in.Comment,
+		Declined:  in.Declined,
+		Previous:  previous,
+	}
+	if err := s.repo.SaveReassignment(ctx, tx, record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+
+func (s *Service) GetReassignments(ctx context.Context, prID string) ([]entity.Reassignment, error) {
+	if _, err := s.repo.GetPR(ctx, prID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetReassignments(ctx, prID)
+}
+
+
+// UndoReassignment reverts the latest reassignment on the PR while it is
+// inside the undo window. reassignmentID, when non-zero, must name that
+// reassignment. The replaced reviewer gets back their previous assignment,
+// including its review state.
+func (s *Service) UndoReassignment(ctx context.Context, prID string, reassignmentID int64) (*entity.PullRequest, *entity.Reassignment, error) {
 	tx, err := s.repo.BeginTx(ctx)
-	if err != nil { 
-		return nil, "", err 
+	if err != nil {
+		return nil, nil, err
 	}
 
 	defer tx.Rollback()
 
-	if err := s.repo.RemoveReviewer(ctx, tx, prID, oldUserID); err != nil {
-		return nil, "", err
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkOpen(pr); err != nil {
+		return nil, nil, err
+	}
+
+	last, err := s.repo.GetLastReassignment(ctx, tx, prID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrUndoUnavailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if last.UndoneAt != nil || (reassignmentID != 0 && last.ID != reassignmentID) {
+		return nil, nil, ErrUndoUnavailable
+	}
+
+	if time.Since(last.CreatedAt) > s.cfg.UndoWindow {
+		return nil, nil, ErrUndoExpired
+	}
+
+	newAssigned, oldAssigned := false, false
+	for _, u := range pr.Reviewers {
+		newAssigned = newAssigned || u.ID == last.NewUserID
+		oldAssigned = oldAssigned || u.ID == last.OldUserID
+	}
+	if !newAssigned || oldAssigned {
+		return nil, nil, ErrUndoUnavailable
+	}
+
+	oldUser, err := s.repo.GetUser(ctx, last.OldUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !oldUser.IsActive {
+		return nil, nil, ErrNotCandidate
+	}
+
+	if err := s.repo.RemoveReviewer(ctx, tx, prID, last.NewUserID); err != nil {
+		return nil, nil, err
+	}
+
+	if last.Previous != nil {
+		err = s.repo.RestoreReviewer(ctx, tx, *last.Previous)
+	} else {
+		err = s.repo.AddReviewer(ctx, tx, prID, last.OldUserID, entity.RoleRequired, entity.ReviewDeadline{})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.repo.MarkReassignmentUndone(ctx, tx, last.ID); err != nil {
+		return nil, nil, err
 	}
 
-	if err := s.repo.AddReviewer(ctx, tx, prID, newReviewer.ID); err != nil {
-		return nil, "", err
+	if err := s.repo.BumpPRVersion(ctx, tx, prID); err != nil {
+		return nil, nil, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	updatedPR, err := s.repo.GetPR(ctx, prID)
-	return updatedPR, newReviewer.ID, err
-}
\ No newline at end of file
+	return updatedPR, last, err
+}
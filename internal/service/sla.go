@@ -0,0 +1,182 @@
+package service
+
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+
+// urgentSLADivisor shortens team SLAs for urgent PRs.
+const urgentSLADivisor = 4
+
+
+// reviewDeadline computes due times for an assignment made at `from`.
+// A zero SLA means the team has no deadline of that kind.
+func reviewDeadline(settings entity.TeamSettings, priority string, from time.Time) entity.ReviewDeadline {
+	var due entity.ReviewDeadline
+
+	if settings.FirstResponseSLA > 0 {
+		t := from.Add(slaDuration(settings.FirstResponseSLA, priority))
+		due.ResponseDueAt = &t
+	}
+	if settings.VerdictSLA > 0 {
+		t := from.Add(slaDuration(settings.VerdictSLA, priority))
+		due.VerdictDueAt = &t
+	}
+	return due
+}
+
+
+func slaDuration(minutes int, priority string) time.Duration {
+	d := time.Duration(minutes) * time.Minute
+	if priority == entity.PriorityUrgent {
+		d /= urgentSLADivisor
+	}
+	return d
+}
+
+
+// RunScheduler periodically runs background jobs until ctx is cancelled.
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.EscalateOverdueReviews(ctx); err != nil {
+				log.Printf("sla escalation failed: %v", err)
+			}
+			if err := s.AssignExpiredPool(ctx); err != nil {
+				log.Printf("pool fallback failed: %v", err)
+			}
+			if err := s.AnonymizeDeparted(ctx); err != nil {
+				log.Printf("anonymization failed: %v", err)
+			}
+		}
+	}
+}
+
+
+func (s *Service) EscalateOverdueReviews(ctx context.Context) error {
+	overdue, err := s.repo.GetOverdueReviews(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range overdue {
+		if err := s.escalate(ctx, o); err != nil {
+			log.Printf("sla: escalation of %s on PR %s failed: %v", o.UserID, o.PRID, err)
+		}
+	}
+	return nil
+}
+
+
+// escalate applies the team's SLA policy to an overdue review. Only
+// transient errors leave the review to the next run; after any other failure
+// the review is marked escalated, so that a PR the policy cannot handle is
+// not retried forever.
+func (s *Service) escalate(ctx context.Context, o entity.OverdueReview) error {
+	var err error
+
+	switch o.SLAPolicy {
+	case entity.SLAPolicyReassign:
+		var res *ReassignResult
+		res, err = s.reassign(ctx, ReassignInput{
+			PRID:      o.PRID,
+			OldUserID: o.UserID,
+			Reason:    entity.ReasonSLAOverdue,
+		})
+		if err == nil {
+			log.Printf("sla: review of PR %s moved from %s to %s", o.PRID, o.UserID, res.ReplacedBy)
+			return nil
+		}
+
+	case entity.SLAPolicyAddReviewer:
+		var newID string
+		newID, err = s.addExtraReviewer(ctx, o.PRID)
+		if err == nil {
+			log.Printf("sla: review of PR %s by %s is overdue, added %s", o.PRID, o.UserID, newID)
+			return s.repo.MarkEscalated(ctx, o.PRID, o.UserID)
+		}
+	}
+
+	switch {
+	case err == nil || errors.Is(err, ErrNoCandidates):
+		log.Printf("sla: review of PR %s by %s is overdue", o.PRID, o.UserID)
+	case storage.IsTransient(err):
+		return err
+	default:
+		log.Printf("sla: review of PR %s by %s is overdue, %s failed: %v", o.PRID, o.UserID, o.SLAPolicy, err)
+	}
+	return s.repo.MarkEscalated(ctx, o.PRID, o.UserID)
+}
+
+
+// addExtraReviewer adds a required reviewer to the PR. The PR stays locked
+// from the check that it is open to the insert, so a concurrent merge or
+// close cannot slip in between.
+func (s *Service) addExtraReviewer(ctx context.Context, prID string) (string, error) {
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback()
+
+	pr, err := s.repo.LockPR(ctx, tx, prID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkOpen(pr); err != nil {
+		return "", err
+	}
+
+	team, err := s.repo.GetTeamTx(ctx, tx, pr.TeamName)
+	if err != nil {
+		return "", err
+	}
+
+	if team.ArchivedAt != nil {
+		return "", ErrNoCandidates
+	}
+
+	settings, err := s.settingsFor(ctx, team, pr.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	exclude := map[string]bool{pr.AuthorID: true}
+	for _, u := range pr.Reviewers {
+		exclude[u.ID] = true
+	}
+
+	candidates, err := s.pickCandidates(ctx, tx, team, exclude, strategyFor(settings, pr.Priority))
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 0 {
+		return "", ErrNoCandidates
+	}
+	newReviewer := candidates[0]
+
+	if err := s.repo.AddReviewer(ctx, tx, prID, newReviewer.ID, entity.RoleRequired, reviewDeadline(settings, pr.Priority, time.Now())); err != nil {
+		return "", err
+	}
+
+	if err := s.repo.BumpPRVersion(ctx, tx, prID); err != nil {
+		return "", err
+	}
+
+	return newReviewer.ID, tx.Commit()
+}
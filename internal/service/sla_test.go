@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/storage"
+)
+
+
+// escalationRepo fails the first step of every SLA policy with err and
+// records which reviews were marked escalated. Other methods are not used.
+type escalationRepo struct {
+	Repository
+	overdue   []entity.OverdueReview
+	err       error
+	escalated []string
+}
+
+func (r *escalationRepo) GetOverdueReviews(ctx context.Context) ([]entity.OverdueReview, error) {
+	return r.overdue, nil
+}
+
+func (r *escalationRepo) BeginTx(ctx context.Context) (*sqlx.Tx, error) {
+	return nil, r.err
+}
+
+func (r *escalationRepo) MarkEscalated(ctx context.Context, prID, userID string) error {
+	r.escalated = append(r.escalated, prID+"/"+userID)
+	return nil
+}
+
+
+func TestEscalateOverdueReviews(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy string
+		err    error
+		marked bool
+	}{
+		{"notify", entity.SLAPolicyNotify, nil, true},
+		{"reassign without candidates", entity.SLAPolicyReassign, ErrNoCandidates, true},
+		{"reassign of a merged PR", entity.SLAPolicyReassign, ErrPRMerged, true},
+		{"reassign of a missing PR", entity.SLAPolicyReassign, storage.ErrNotFound, true},
+		{"reassign on a lost connection", entity.SLAPolicyReassign, driver.ErrBadConn, false},
+		{"reassign on a deadlock", entity.SLAPolicyReassign, &pq.Error{Code: "40P01"}, false},
+		{"reassign on a constraint violation", entity.SLAPolicyReassign, &pq.Error{Code: "23505"}, true},
+		{"add reviewer without candidates", entity.SLAPolicyAddReviewer, ErrNoCandidates, true},
+		{"add reviewer of a missing PR", entity.SLAPolicyAddReviewer, storage.ErrNotFound, true},
+		{"add reviewer on a timeout", entity.SLAPolicyAddReviewer, context.DeadlineExceeded, false},
+	}
+
+	for _, tc := range cases {
+		repo := &escalationRepo{
+			overdue: []entity.OverdueReview{{PRID: "pr-1", UserID: "u1", TeamName: "web", SLAPolicy: tc.policy}},
+			err:     tc.err,
+		}
+		svc := New(repo, Config{})
+
+		if err := svc.EscalateOverdueReviews(context.Background()); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if marked := len(repo.escalated) == 1; marked != tc.marked {
+			t.Errorf("%s: marked escalated = %v, want %v", tc.name, marked, tc.marked)
+		}
+	}
+}
+
+
+func TestReviewDeadline(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	settings := entity.TeamSettings{FirstResponseSLA: 60, VerdictSLA: 240}
+
+	due := reviewDeadline(settings, entity.PriorityNormal, from)
+	if due.ResponseDueAt == nil || !due.ResponseDueAt.Equal(from.Add(time.Hour)) {
+		t.Errorf("response due = %v, want in an hour", due.ResponseDueAt)
+	}
+	if due.VerdictDueAt == nil || !due.VerdictDueAt.Equal(from.Add(4*time.Hour)) {
+		t.Errorf("verdict due = %v, want in 4 hours", due.VerdictDueAt)
+	}
+
+	due = reviewDeadline(settings, entity.PriorityUrgent, from)
+	if !due.ResponseDueAt.Equal(from.Add(15*time.Minute)) || !due.VerdictDueAt.Equal(from.Add(time.Hour)) {
+		t.Errorf("urgent deadlines = %v, %v, want a quarter of the SLA", due.ResponseDueAt, due.VerdictDueAt)
+	}
+
+	if due := reviewDeadline(entity.TeamSettings{}, entity.PriorityUrgent, from); due.ResponseDueAt != nil || due.VerdictDueAt != nil {
+		t.Errorf("deadlines without SLA = %+v, want none", due)
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+func (s *Service) GetStack(ctx context.Context, prID string) ([]entity.PullRequest, error) {
+	if _, err := s.repo.GetPR(ctx, prID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetStack(ctx, prID)
+}
+
+
+// preferReviewers moves the parent PR reviewers to the front of candidates,
+// keeping the relative order of both groups.
+func preferReviewers(candidates []entity.TeamMember, reviewers []entity.Reviewer) []entity.TeamMember {
+	inherited := make(map[string]bool, len(reviewers))
+	for _, u := range reviewers {
+		inherited[u.ID] = true
+	}
+
+	ordered := make([]entity.TeamMember, 0, len(candidates))
+	for _, u := range candidates {
+		if inherited[u.ID] {
+			ordered = append(ordered, u)
+		}
+	}
+	for _, u := range candidates {
+		if !inherited[u.ID] {
+			ordered = append(ordered, u)
+		}
+	}
+	return ordered
+}
+
+
+// propagateReassign replaces in.OldUserID on every PR stacked above in.PRID.
+// The new reviewer of the base PR is preferred; when they cannot take a PR,
+// a random candidate is used instead. PRs where the old user is not assigned,
+// that are no longer open or have no candidates are left untouched.
+func (s *Service) propagateReassign(ctx context.Context, tx *sqlx.Tx, in ReassignInput, newUserID string) ([]entity.Reassignment, error) {
+	ids, err := s.repo.GetDescendantIDs(ctx, tx, in.PRID)
+	if err != nil {
+		return nil, err
+	}
+
+	propagated := make([]entity.Reassignment, 0, len(ids))
+	for _, id := range ids {
+		sub := in
+		sub.PRID = id
+		sub.NewUserID = newUserID
+
+		record, err := s.reassignTx(ctx, tx, sub)
+		if errors.Is(err, ErrNotCandidate) {
+			sub.NewUserID = ""
+			record, err = s.reassignTx(ctx, tx, sub)
+		}
+
+		switch {
+		case errors.Is(err, ErrNotAssigned), errors.Is(err, ErrPRMerged), errors.Is(err, ErrPRClosed), errors.Is(err, ErrNoCandidates):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		propagated = append(propagated, *record)
+	}
+	return propagated, nil
+}
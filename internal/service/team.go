@@ -0,0 +1,198 @@
+package service
+
+
+import (
+	"context"
+
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+// AddTeamMembers adds users to an existing team or updates their membership.
+// Users keep their other teams unless moveMembers is set.
+func (s *Service) AddTeamMembers(ctx context.Context, teamName string, members []entity.TeamMember, moveMembers bool) (*entity.Team, error) {
+	if len(members) == 0 {
+		return nil, ErrInvalidTeam
+	}
+	if err := normalizeMembers(members); err != nil {
+		return nil, err
+	}
+	if err := s.rejectDeparted(ctx, members); err != nil {
+		return nil, err
+	}
+
+	team, err := s.repo.GetTeam(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	if team.ArchivedAt != nil {
+		return nil, ErrTeamArchived
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	moved, err := s.movedMembers(ctx, tx, teamName, members, moveMembers)
+	if err != nil {
+		return nil, err
+	}
+
+	deactivated, err := s.repo.LockActiveUsers(ctx, tx, inactiveIDs(members))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.AddTeamMembers(ctx, tx, teamName, members); err != nil {
+		return nil, err
+	}
+
+	if err := s.reassignDeactivated(ctx, tx, deactivated); err != nil {
+		return nil, err
+	}
+
+	if err := s.recordMoves(ctx, tx, teamName, moved); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetTeam(ctx, teamName)
+}
+
+
+// RemoveTeamMember ends the user's membership in the team. With the reassign
+// policy their open reviews on the team's PRs are handed to other members in
+// the same transaction; PRs without a replacement candidate are returned in
+// the second slice.
+func (s *Service) RemoveTeamMember(ctx context.Context, teamName, userID, policy string) ([]entity.Reassignment, []string, error) {
+	if policy == "" {
+		policy = entity.MemberReviewsKeep
+	}
+	if policy != entity.MemberReviewsKeep && policy != entity.MemberReviewsReassign {
+		return nil, nil, ErrInvalidTeam
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.repo.LockUser(ctx, tx, userID); err != nil {
+		return nil, nil, err
+	}
+
+	reassigned := make([]entity.Reassignment, 0)
+	skipped := make([]string, 0)
+
+	if policy == entity.MemberReviewsReassign {
+		if reassigned, skipped, err = s.reassignAll(ctx, tx, userID, teamName, entity.ReasonLeftTeam); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := s.repo.RemoveTeamMember(ctx, tx, teamName, userID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return reassigned, skipped, nil
+}
+
+
+func (s *Service) RenameTeam(ctx context.Context, oldName, newName string) (*entity.Team, error) {
+	if newName == "" {
+		return nil, ErrInvalidTeam
+	}
+	if newName == oldName {
+		return s.repo.GetTeam(ctx, oldName)
+	}
+
+	if err := s.repo.RenameTeam(ctx, oldName, newName); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTeam(ctx, newName)
+}
+
+
+// ArchiveTeam hides the team from assignment or brings it back. Members,
+// PRs and history are kept.
+func (s *Service) ArchiveTeam(ctx context.Context, name string, archived bool) (*entity.Team, error) {
+	if err := s.repo.SetTeamArchived(ctx, name, archived); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTeam(ctx, name)
+}
+
+
+// DeleteTeam removes a team. Without targetTeam the team must have no
+// members and no open PRs; otherwise those are moved to targetTeam first.
+// It returns the moved user and PR IDs.
+func (s *Service) DeleteTeam(ctx context.Context, name, targetTeam string) ([]string, []string, error) {
+	if name == targetTeam {
+		return nil, nil, ErrInvalidTeam
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	// Both teams are locked in name order, so the target cannot be archived
+	// or deleted while the members move and concurrent deletes don't deadlock.
+	if targetTeam != "" {
+		if err := s.repo.LockTeams(ctx, tx, name, targetTeam); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	members, openPRs, err := s.repo.LockTeam(ctx, tx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	movedUsers, movedPRs := []string{}, []string{}
+	if targetTeam != "" {
+		target, err := s.repo.GetTeam(ctx, targetTeam)
+		if err != nil {
+			return nil, nil, err
+		}
+		if target.ArchivedAt != nil {
+			return nil, nil, ErrTeamArchived
+		}
+
+		if movedUsers, movedPRs, err = s.repo.MoveTeamMembers(ctx, tx, name, targetTeam); err != nil {
+			return nil, nil, err
+		}
+	} else if members > 0 || openPRs > 0 {
+		return nil, nil, ErrTeamInUse
+	}
+
+	if err := s.repo.DeleteTeam(ctx, tx, name); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	if movedUsers == nil {
+		movedUsers = []string{}
+	}
+	if movedPRs == nil {
+		movedPRs = []string{}
+	}
+	return movedUsers, movedPRs, nil
+}
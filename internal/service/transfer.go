@@ -0,0 +1,211 @@
+package service
+
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"ex8ed/pullreq-assigner/internal/entity"
+)
+
+
+type TransferInput struct {
+	UserID   string
+	TeamName string
+
+	// FromTeam is the membership being moved; the home team by default.
+	FromTeam     string
+	ReviewPolicy string
+	PRPolicy     string
+}
+
+
+type TransferResult struct {
+	User       *entity.User
+	Transfer   entity.TeamTransfer
+	Reassigned []entity.Reassignment
+	Skipped    []string
+	MovedPRs   []string
+}
+
+
+// TransferUser moves one of the user's memberships to another team and
+// records the move; other memberships are kept. The review policy decides
+// whether the user's open reviews on PRs of the old team are reassigned; the
+// PR policy decides whether their open PRs of that team follow them.
+func (s *Service) TransferUser(ctx context.Context, in TransferInput) (*TransferResult, error) {
+	if in.ReviewPolicy == "" {
+		in.ReviewPolicy = s.cfg.TransferReviewPolicy
+	}
+	if in.PRPolicy == "" {
+		in.PRPolicy = s.cfg.TransferPRPolicy
+	}
+	if in.ReviewPolicy != entity.MemberReviewsKeep && in.ReviewPolicy != entity.MemberReviewsReassign {
+		return nil, ErrInvalidTeam
+	}
+	if in.PRPolicy != entity.AuthoredPRsKeep && in.PRPolicy != entity.AuthoredPRsMove {
+		return nil, ErrInvalidTeam
+	}
+
+	target, err := s.repo.GetTeam(ctx, in.TeamName)
+	if err != nil {
+		return nil, err
+	}
+	if target.ArchivedAt != nil {
+		return nil, ErrTeamArchived
+	}
+
+	tx, err := s.repo.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	if err := s.repo.LockUser(ctx, tx, in.UserID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUser(ctx, in.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DepartedAt != nil {
+		return nil, ErrUserDeparted
+	}
+	if in.FromTeam == "" {
+		in.FromTeam = user.TeamName
+	}
+	if in.FromTeam != "" && !contains(user.Teams, in.FromTeam) {
+		return nil, ErrNotMember
+	}
+	if in.FromTeam == in.TeamName || contains(user.Teams, in.TeamName) {
+		return nil, ErrInvalidTeam
+	}
+
+	res := &TransferResult{
+		Reassigned: make([]entity.Reassignment, 0),
+		Skipped:    make([]string, 0),
+		MovedPRs:   make([]string, 0),
+	}
+
+	if in.ReviewPolicy == entity.MemberReviewsReassign {
+		if res.Reassigned, res.Skipped, err = s.reassignAll(ctx, tx, in.UserID, in.FromTeam, entity.ReasonTransferred); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.MoveMembership(ctx, tx, in.UserID, in.FromTeam, in.TeamName); err != nil {
+		return nil, err
+	}
+
+	if in.PRPolicy == entity.AuthoredPRsMove {
+		moved, err := s.repo.MoveAuthoredPRs(ctx, tx, in.UserID, in.FromTeam, in.TeamName)
+		if err != nil {
+			return nil, err
+		}
+		if moved != nil {
+			res.MovedPRs = moved
+		}
+	}
+
+	res.Transfer = entity.TeamTransfer{
+		UserID:       in.UserID,
+		FromTeam:     in.FromTeam,
+		ToTeam:       in.TeamName,
+		ReviewPolicy: in.ReviewPolicy,
+		PRPolicy:     in.PRPolicy,
+	}
+	if err := s.repo.SaveTransfer(ctx, tx, &res.Transfer); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if res.User, err = s.repo.GetUser(ctx, in.UserID); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+
+func (s *Service) GetTransfers(ctx context.Context, userID string) ([]entity.TeamTransfer, error) {
+	if _, err := s.repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetTransfers(ctx, userID)
+}
+
+
+// movedMembers returns the members that belong to teams other than teamName
+// and, with move set, are to leave them. Without move nobody is moved. The
+// members are locked in tx first, so their memberships stay as read until
+// the moves are recorded.
+func (s *Service) movedMembers(ctx context.Context, tx *sqlx.Tx, teamName string, members []entity.TeamMember, move bool) ([]entity.User, error) {
+	if !move {
+		return []entity.User{}, nil
+	}
+
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.ID)
+	}
+
+	locked, err := s.repo.LockUsers(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetUsers(ctx, locked)
+	if err != nil {
+		return nil, err
+	}
+
+	moved := make([]entity.User, 0)
+	for _, u := range existing {
+		if len(u.Teams) == 0 || (len(u.Teams) == 1 && u.Teams[0] == teamName) {
+			continue
+		}
+		moved = append(moved, u)
+	}
+	return moved, nil
+}
+
+
+// recordMoves ends the other memberships of members moved into teamName by a
+// team call and adds a transfer history entry for every team left. Their
+// reviews and PRs are left as they are.
+func (s *Service) recordMoves(ctx context.Context, tx *sqlx.Tx, teamName string, moved []entity.User) error {
+	for _, u := range moved {
+		left, err := s.repo.RemoveMemberships(ctx, tx, u.ID, teamName)
+		if err != nil {
+			return err
+		}
+
+		for _, from := range left {
+			err := s.repo.SaveTransfer(ctx, tx, &entity.TeamTransfer{
+				UserID:       u.ID,
+				FromTeam:     from,
+				ToTeam:       teamName,
+				ReviewPolicy: entity.MemberReviewsKeep,
+				PRPolicy:     entity.AuthoredPRsKeep,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
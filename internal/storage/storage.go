@@ -4,13 +4,22 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
 
 	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/migrations"
 )
 
 
@@ -20,6 +29,36 @@ var (
 )
 
 
+// IsTransient reports whether err may go away on retry: lost connections,
+// cancelled contexts, deadlocks and serialization failures, or a server out
+// of resources.
+func IsTransient(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "40", "53", "57":
+			return true
+		}
+	}
+	return false
+}
+
+
+// maxTeamDepth bounds walks over the team hierarchy, so that a cycle left in
+// the data cannot make them run forever.
+const maxTeamDepth = 100
+
+
 type Storage struct {
 	db *sqlx.DB
 }
@@ -34,29 +73,192 @@ func (s *Storage) BeginTx(ctx context.Context) (*sqlx.Tx, error) {
 	return s.db.BeginTxx(ctx, nil)
 }
 
+
+// noTransaction starts migrations that cannot run in a transaction, such as
+// concurrent index builds.
+const noTransaction = "-- migrate: no transaction"
+
+
+// migrationLock is the advisory lock held while migrating, so that servers
+// starting at the same time apply each migration once.
+const migrationLock = 8138001
+
+
+// Migrate applies the numbered migrations that have not been applied yet and
+// records them in schema_migrations. Each runs in its own transaction, except
+// those marked with noTransaction, which run statement by statement.
+func (s *Storage) Migrate(ctx context.Context) error {
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return err
+	}
+
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			name        VARCHAR(255) PRIMARY KEY,
+			applied_at  TIMESTAMP    NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrations.FS, "[0-9]*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := migrate(ctx, conn, name); err != nil {
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+
+func migrate(ctx context.Context, conn *sqlx.Conn, name string) error {
+	var applied bool
+	err := conn.GetContext(ctx, &applied, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE name = $1)", name)
+	if err != nil || applied {
+		return err
+	}
+
+	script, err := migrations.FS.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(string(script), noTransaction) {
+		for _, stmt := range statements(string(script)) {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (name) VALUES ($1)", name)
+		return err
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (name) VALUES ($1)", name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+
+// statements splits a script into its statements. It only handles scripts
+// without semicolons in strings, comments or function bodies.
+func statements(script string) []string {
+	stmts := make([]string, 0)
+	for _, stmt := range strings.Split(script, ";") {
+		code := false
+		for _, line := range strings.Split(stmt, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "--") {
+				code = true
+			}
+		}
+		if code {
+			stmts = append(stmts, strings.TrimSpace(stmt))
+		}
+	}
+	return stmts
+}
+
 // =====================================================================
 // TEAMS & USERS
 // =====================================================================
 
-func (s *Storage) CreateTeam(ctx context.Context, team entity.Team) error {
-	_, err := s.db.NamedExecContext(ctx, `INSERT INTO teams (name) VALUES (:name)`, team)
+// homeTeam selects the first team the user aliased as alias joined, or ''.
+func homeTeam(alias string) string {
+	return `COALESCE((SELECT tm.team_name FROM team_members tm WHERE tm.user_id = ` + alias +
+		`.id ORDER BY tm.joined_at, tm.team_name LIMIT 1), '')`
+}
+
+
+// userColumns selects a users row with the user's home team and all teams.
+var userColumns = `id, username, is_active, role AS user_role, departed_at, ` + homeTeam("users") + ` AS team_name,
+	ARRAY(SELECT tm.team_name FROM team_members tm WHERE tm.user_id = users.id ORDER BY tm.joined_at, tm.team_name) AS teams,
+	COALESCE((SELECT tm.role = 'onboarding' FROM team_members tm WHERE tm.user_id = users.id
+		ORDER BY tm.joined_at, tm.team_name LIMIT 1), FALSE) AS is_onboarding`
+
+
+// memberSelect lists team members; callers append conditions on tm.
+const memberSelect = `
+	SELECT u.id, u.username, u.is_active, u.role AS user_role, tm.team_name, tm.role AS team_role, tm.weight,
+		tm.role = 'onboarding' AS is_onboarding
+	FROM team_members tm
+	JOIN users u ON u.id = tm.user_id
+`
+
+
+func (s *Storage) CreateTeam(ctx context.Context, tx *sqlx.Tx, team entity.Team) error {
+	_, err := tx.NamedExecContext(ctx, `
+		INSERT INTO teams (
+			name, first_response_sla_minutes, verdict_sla_minutes, sla_policy,
+			reviewers_count, required_approvals, stale_approvals, assignment_strategy,
+			assignment_mode, pool_timeout_minutes, shadow_share_percent, parent_team
+		)
+		VALUES (
+			:name, :first_response_sla_minutes, :verdict_sla_minutes, :sla_policy,
+			:reviewers_count, :required_approvals, :stale_approvals, :assignment_strategy,
+			:assignment_mode, :pool_timeout_minutes, :shadow_share_percent, :parent_team
+		)
+	`, team)
 
 	if err != nil {
 		return err
 	}
 
-	query := `
-		INSERT INTO users (id, username, is_active, team_name)
-		VALUES (:id, :username, :is_active, :team_name)
+	return upsertMembers(ctx, tx, team.Name, team.Members)
+}
+
+
+// upsertMembers creates or updates the users and their membership in
+// teamName. Memberships in other teams are left alone. An empty user or team
+// role and a zero weight keep the stored values, defaulting to member and 1.
+func upsertMembers(ctx context.Context, e sqlx.ExtContext, teamName string, members []entity.TeamMember) error {
+	userQuery := `
+		INSERT INTO users (id, username, is_active, role)
+		VALUES (:id, :username, :is_active, COALESCE(NULLIF(:user_role, ''), 'member'))
 		ON CONFLICT (id) DO UPDATE SET
 			username = EXCLUDED.username,
 			is_active = EXCLUDED.is_active,
-			team_name = EXCLUDED.team_name;
+			role = COALESCE(NULLIF(:user_role, ''), users.role);
 	`
-	for _, member := range team.Members {
-		member.TeamName = team.Name
+	memberQuery := `
+		INSERT INTO team_members (team_name, user_id, role, weight)
+		VALUES (:team_name, :id, COALESCE(NULLIF(:team_role, ''), 'member'), GREATEST(:weight, 1))
+		ON CONFLICT (team_name, user_id) DO UPDATE SET
+			role = COALESCE(NULLIF(:team_role, ''), team_members.role),
+			weight = COALESCE(NULLIF(:weight, 0), team_members.weight);
+	`
+	for _, member := range members {
+		member.TeamName = teamName
 		
-		if _, err := s.db.NamedExecContext(ctx, query, member); err != nil {
+		if _, err := sqlx.NamedExecContext(ctx, e, userQuery, member); err != nil {
+			return err
+		}
+		if _, err := sqlx.NamedExecContext(ctx, e, memberQuery, member); err != nil {
 			return err
 		}
 	}
@@ -65,9 +267,89 @@ func (s *Storage) CreateTeam(ctx context.Context, team entity.Team) error {
 }
 
 
+func (s *Storage) AddTeamMembers(ctx context.Context, tx *sqlx.Tx, teamName string, members []entity.TeamMember) error {
+	var name string
+	err := tx.GetContext(ctx, &name, "SELECT name FROM teams WHERE name = $1 FOR SHARE", teamName)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return upsertMembers(ctx, tx, teamName, members)
+}
+
+
+// AddMembership makes the user a regular member of the team unless they
+// already are one.
+func (s *Storage) AddMembership(ctx context.Context, tx *sqlx.Tx, teamName, userID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO team_members (team_name, user_id) VALUES ($1, $2)
+		ON CONFLICT (team_name, user_id) DO NOTHING
+	`, teamName, userID)
+	return err
+}
+
+
+// RemoveAllMembers ends every membership in the team.
+func (s *Storage) RemoveAllMembers(ctx context.Context, tx *sqlx.Tx, teamName string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM team_members WHERE team_name = $1", teamName)
+	return err
+}
+
+
+// RemoveTeamMember ends the user's membership in the team; the user and
+// their other memberships are kept.
+func (s *Storage) RemoveTeamMember(ctx context.Context, tx *sqlx.Tx, teamName, userID string) error {
+	res, err := tx.ExecContext(ctx,
+		"DELETE FROM team_members WHERE team_name = $1 AND user_id = $2", teamName, userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+// RenameTeam renames the team; memberships, PRs and repository settings
+// follow through ON UPDATE CASCADE.
+func (s *Storage) RenameTeam(ctx context.Context, oldName, newName string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE teams SET name = $1 WHERE name = $2", newName, oldName)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" {
+				return ErrAlreadyExists
+			}
+		}
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
 func (s *Storage) GetTeam(ctx context.Context, name string) (*entity.Team, error) {
+	return getTeam(ctx, s.db, name)
+}
+
+
+// GetTeamTx loads the team inside tx, so that members changed earlier in tx
+// are seen as changed.
+func (s *Storage) GetTeamTx(ctx context.Context, tx *sqlx.Tx, name string) (*entity.Team, error) {
+	return getTeam(ctx, tx, name)
+}
+
+
+func getTeam(ctx context.Context, q sqlx.QueryerContext, name string) (*entity.Team, error) {
 	var team entity.Team
-	err := s.db.GetContext(ctx, &team, "SELECT name FROM teams WHERE name = $1", name)
+	err := sqlx.GetContext(ctx, q, &team, "SELECT * FROM teams WHERE name = $1", name)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
@@ -77,7 +359,13 @@ func (s *Storage) GetTeam(ctx context.Context, name string) (*entity.Team, error
 		return nil, err
 	}
 
-	err = s.db.SelectContext(ctx, &team.Members, "SELECT * FROM users WHERE team_name = $1", name)
+	err = sqlx.SelectContext(ctx, q, &team.Members, memberSelect+" WHERE tm.team_name = $1 ORDER BY tm.joined_at, u.id", name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlx.SelectContext(ctx, q, &team.Repositories,
+		"SELECT * FROM team_repository_settings WHERE team_name = $1 ORDER BY repository", name)
 	if err != nil {
 		return nil, err
 	}
@@ -86,18 +374,63 @@ func (s *Storage) GetTeam(ctx context.Context, name string) (*entity.Team, error
 }
 
 
-func (s *Storage) GetUser(ctx context.Context, userID string) (*entity.User, error) {
-	var user entity.User
-	err := s.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id = $1", userID)
-	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
-	}
-	return &user, err
+func (s *Storage) ListTeamNames(ctx context.Context) ([]string, error) {
+	var names []string
+	err := s.db.SelectContext(ctx, &names, "SELECT name FROM teams ORDER BY name")
+	return names, err
 }
 
 
-func (s *Storage) SetUserActive(ctx context.Context, userID string, isActive bool) error {
-	res, err := s.db.ExecContext(ctx, "UPDATE users SET is_active = $1 WHERE id = $2", isActive, userID)
+// FindTeamNames lists the names of teams whose name equals the given one,
+// ignoring case.
+func (s *Storage) FindTeamNames(ctx context.Context, name string) ([]string, error) {
+	names := make([]string, 0)
+	err := s.db.SelectContext(ctx, &names, "SELECT name FROM teams WHERE LOWER(name) = LOWER($1) ORDER BY name", name)
+	return names, err
+}
+
+
+// UpsertTeam creates the team or overwrites its settings and parent, and
+// brings it back from the archive. Members are not touched.
+func (s *Storage) UpsertTeam(ctx context.Context, tx *sqlx.Tx, team entity.Team) error {
+	_, err := tx.NamedExecContext(ctx, `
+		INSERT INTO teams (
+			name, first_response_sla_minutes, verdict_sla_minutes, sla_policy,
+			reviewers_count, required_approvals, stale_approvals, assignment_strategy,
+			assignment_mode, pool_timeout_minutes, shadow_share_percent, parent_team
+		)
+		VALUES (
+			:name, :first_response_sla_minutes, :verdict_sla_minutes, :sla_policy,
+			:reviewers_count, :required_approvals, :stale_approvals, :assignment_strategy,
+			:assignment_mode, :pool_timeout_minutes, :shadow_share_percent, :parent_team
+		)
+		ON CONFLICT (name) DO UPDATE SET
+			first_response_sla_minutes = EXCLUDED.first_response_sla_minutes,
+			verdict_sla_minutes = EXCLUDED.verdict_sla_minutes,
+			sla_policy = EXCLUDED.sla_policy,
+			reviewers_count = EXCLUDED.reviewers_count,
+			required_approvals = EXCLUDED.required_approvals,
+			stale_approvals = EXCLUDED.stale_approvals,
+			assignment_strategy = EXCLUDED.assignment_strategy,
+			assignment_mode = EXCLUDED.assignment_mode,
+			pool_timeout_minutes = EXCLUDED.pool_timeout_minutes,
+			shadow_share_percent = EXCLUDED.shadow_share_percent,
+			parent_team = EXCLUDED.parent_team,
+			archived_at = NULL
+	`, team)
+	return err
+}
+
+
+func (s *Storage) ArchiveTeams(ctx context.Context, tx *sqlx.Tx, names []string) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE teams SET archived_at = COALESCE(archived_at, NOW()) WHERE name = ANY($1)", pq.Array(names))
+	return err
+}
+
+
+func (s *Storage) SetTeamParent(ctx context.Context, tx *sqlx.Tx, name string, parent *string) error {
+	res, err := tx.ExecContext(ctx, "UPDATE teams SET parent_team = $1 WHERE name = $2", parent, name)
 	if err != nil {
 		return err
 	}
@@ -109,116 +442,1211 @@ func (s *Storage) SetUserActive(ctx context.Context, userID string, isActive boo
 }
 
 
-func (s *Storage) GetTeamMembers(ctx context.Context, teamName string) ([]entity.User, error) {
-	var users []entity.User
-	err := s.db.SelectContext(ctx, &users, "SELECT * FROM users WHERE team_name = $1", teamName)
-	return users, err
+// ancestorsQuery walks up the parent chain of $1, at most $2 levels.
+const ancestorsQuery = `
+	WITH RECURSIVE up AS (
+		SELECT parent_team AS name, 1 AS depth FROM teams WHERE name = $1
+		UNION ALL
+		SELECT t.parent_team, up.depth + 1 FROM teams t JOIN up ON t.name = up.name
+		WHERE up.depth < $2
+	)
+`
+
+
+// GetTeamAncestors returns the parent chain of the team, nearest first.
+func (s *Storage) GetTeamAncestors(ctx context.Context, name string) ([]string, error) {
+	return getTeamAncestors(ctx, s.db, name)
 }
 
-// =====================================================================
-// PULL REQUESTS
-// =====================================================================
 
+// GetTeamAncestorsTx returns the parent chain of the team as seen inside tx.
+func (s *Storage) GetTeamAncestorsTx(ctx context.Context, tx *sqlx.Tx, name string) ([]string, error) {
+	return getTeamAncestors(ctx, tx, name)
+}
 
-func (s *Storage) SavePR(ctx context.Context, tx *sqlx.Tx, pr entity.PullRequest) error {
+
+func getTeamAncestors(ctx context.Context, q sqlx.QueryerContext, name string) ([]string, error) {
+	var names []string
+	query := ancestorsQuery + "SELECT name FROM up WHERE name IS NOT NULL ORDER BY depth"
+	err := sqlx.SelectContext(ctx, q, &names, query, name, maxTeamDepth)
+	return names, err
+}
+
+
+// LockTeamAncestors locks the parent chain of the team until tx ends and
+// returns it, nearest first.
+func (s *Storage) LockTeamAncestors(ctx context.Context, tx *sqlx.Tx, name string) ([]string, error) {
+	var names []string
+	query := ancestorsQuery + "SELECT t.name FROM up JOIN teams t ON t.name = up.name ORDER BY up.depth FOR UPDATE OF t"
+	err := tx.SelectContext(ctx, &names, query, name, maxTeamDepth)
+	return names, err
+}
+
+
+// LockOrg blocks changes to teams, memberships and users by others until tx
+// ends; reads go on.
+func (s *Storage) LockOrg(ctx context.Context, tx *sqlx.Tx) error {
+	_, err := tx.ExecContext(ctx, "LOCK TABLE teams, team_members, users IN SHARE ROW EXCLUSIVE MODE")
+	return err
+}
+
+
+// GetTeamDescendants returns every team below the given one, nearest first,
+// at most maxTeamDepth levels down.
+func (s *Storage) GetTeamDescendants(ctx context.Context, name string) ([]string, error) {
+	var names []string
 	query := `
-		INSERT INTO pull_requests (id, name, author_id, status, created_at)
-		VALUES (:id, :name, :author_id, :status, :created_at)
+		WITH RECURSIVE down AS (
+			SELECT name, 1 AS depth FROM teams WHERE parent_team = $1
+			UNION ALL
+			SELECT t.name, down.depth + 1 FROM teams t JOIN down ON t.parent_team = down.name
+			WHERE down.depth < $2
+		)
+		SELECT name FROM down WHERE name <> $1 GROUP BY name ORDER BY MIN(depth), name
 	`
-	_, err := tx.NamedExecContext(ctx, query, pr)
+	err := s.db.SelectContext(ctx, &names, query, name, maxTeamDepth)
+	return names, err
+}
+
 
+func (s *Storage) SetTeamArchived(ctx context.Context, name string, archived bool) error {
+	query := "UPDATE teams SET archived_at = CASE WHEN $1 THEN COALESCE(archived_at, NOW()) END WHERE name = $2"
+	res, err := s.db.ExecContext(ctx, query, archived, name)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" {
-				return ErrAlreadyExists
-			}
-		}
 		return err
 	}
-
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
 	return nil
 }
 
 
-func (s *Storage) SaveReviewers(ctx context.Context, tx *sqlx.Tx, prID string, reviewerIDs []string) error {
-	for _, uid := range reviewerIDs {
-		_, err := tx.ExecContext(ctx, 
-			"INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ($1, $2)", 
-			prID, uid)
-		if err != nil {
-			return err
+// LockTeams locks the teams until tx ends, in name order so that concurrent
+// callers do not deadlock.
+func (s *Storage) LockTeams(ctx context.Context, tx *sqlx.Tx, names ...string) error {
+	var locked []string
+	err := tx.SelectContext(ctx, &locked,
+		"SELECT name FROM teams WHERE name = ANY($1) ORDER BY name FOR UPDATE", pq.Array(names))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		found := false
+		for _, l := range locked {
+			found = found || l == name
+		}
+		if !found {
+			return ErrNotFound
 		}
 	}
 	return nil
 }
 
-func (s *Storage) GetPR(ctx context.Context, prID string) (*entity.PullRequest, error) {
-	var pr entity.PullRequest
-
-	err := s.db.GetContext(ctx, &pr, "SELECT * FROM pull_requests WHERE id = $1", prID)
 
+// LockTeam locks the team row until tx ends and reports how many members and
+// open PRs still reference it.
+func (s *Storage) LockTeam(ctx context.Context, tx *sqlx.Tx, name string) (members, openPRs int, err error) {
+	var locked string
+	err = tx.GetContext(ctx, &locked, "SELECT name FROM teams WHERE name = $1 FOR UPDATE", name)
 	if err == sql.ErrNoRows {
-		return nil, ErrNotFound
+		return 0, 0, ErrNotFound
 	}
-
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
 
-	var reviewerIDs []string
-	err = s.db.SelectContext(ctx, &reviewerIDs, "SELECT user_id FROM pr_reviewers WHERE pull_request_id = $1", prID)
-	
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM team_members WHERE team_name = $1),
+			(SELECT COUNT(*) FROM pull_requests WHERE team_name = $1 AND status = 'OPEN')
+	`
+	err = tx.QueryRowxContext(ctx, query, name).Scan(&members, &openPRs)
+	return members, openPRs, err
+}
+
+
+// MoveTeamMembers moves all members and open PRs of one team to another and
+// returns the moved user and PR IDs. Members already in the target team keep
+// their membership there.
+func (s *Storage) MoveTeamMembers(ctx context.Context, tx *sqlx.Tx, from, to string) ([]string, []string, error) {
+	var userIDs, prIDs []string
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO team_members (team_name, user_id, role, weight, joined_at)
+		SELECT $1, user_id, role, weight, joined_at FROM team_members WHERE team_name = $2
+		ON CONFLICT (team_name, user_id) DO NOTHING
+	`, to, from)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	
-	for _, rid := range reviewerIDs {
-		pr.Reviewers = append(pr.Reviewers, entity.User{ID: rid})
+
+	err = tx.SelectContext(ctx, &userIDs,
+		"DELETE FROM team_members WHERE team_name = $1 RETURNING user_id", from)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return &pr, nil
+	err = tx.SelectContext(ctx, &prIDs,
+		"UPDATE pull_requests SET team_name = $1 WHERE team_name = $2 AND status = 'OPEN' RETURNING id", to, from)
+	return userIDs, prIDs, err
 }
 
-func (s *Storage) MergePR(ctx context.Context, prID string) (*entity.PullRequest, error) {
+
+// DeleteTeam removes the team with its repository settings. Closed and merged
+// PRs of the team are kept without a team.
+func (s *Storage) DeleteTeam(ctx context.Context, tx *sqlx.Tx, name string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM teams WHERE name = $1", name)
+	return err
+}
+
+
+func (s *Storage) SaveRepositorySettings(ctx context.Context, rs entity.RepositorySettings) error {
 	query := `
-		UPDATE pull_requests 
-		SET status = 'MERGED', merged_at = NOW() 
-		WHERE id = $1 AND status = 'OPEN'
+		INSERT INTO team_repository_settings (team_name, repository, reviewers_count, assignment_strategy)
+		VALUES (:team_name, :repository, :reviewers_count, :assignment_strategy)
+		ON CONFLICT (team_name, repository) DO UPDATE SET
+			reviewers_count = EXCLUDED.reviewers_count,
+			assignment_strategy = EXCLUDED.assignment_strategy
 	`
-	_, err := s.db.ExecContext(ctx, query, prID)
+	_, err := s.db.NamedExecContext(ctx, query, rs)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23503" {
+				return ErrNotFound
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+
+func (s *Storage) GetRepositorySettings(ctx context.Context, teamName, repository string) (*entity.RepositorySettings, error) {
+	var rs entity.RepositorySettings
+	err := s.db.GetContext(ctx, &rs,
+		"SELECT * FROM team_repository_settings WHERE team_name = $1 AND repository = $2", teamName, repository)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	
-	return s.GetPR(ctx, prID)
+	return &rs, nil
 }
 
 
-// =====================================================================
-// REASSIGN (Сложная логика)
-// =====================================================================
+func (s *Storage) UpdateTeamSettings(ctx context.Context, team entity.Team) error {
+	query := `
+		UPDATE teams SET
+			first_response_sla_minutes = :first_response_sla_minutes,
+			verdict_sla_minutes = :verdict_sla_minutes,
+			sla_policy = :sla_policy,
+			reviewers_count = :reviewers_count,
+			required_approvals = :required_approvals,
+			stale_approvals = :stale_approvals,
+			assignment_strategy = :assignment_strategy,
+			assignment_mode = :assignment_mode,
+			pool_timeout_minutes = :pool_timeout_minutes,
+			shadow_share_percent = :shadow_share_percent
+		WHERE name = :name
+	`
+	res, err := s.db.NamedExecContext(ctx, query, team)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
 
 
-func (s *Storage) RemoveReviewer(ctx context.Context, tx *sqlx.Tx, prID, userID string) error {
-	_, err := tx.ExecContext(ctx, "DELETE FROM pr_reviewers WHERE pull_request_id=$1 AND user_id=$2", prID, userID)
-	return err
+func (s *Storage) GetUser(ctx context.Context, userID string) (*entity.User, error) {
+	var user entity.User
+	err := s.db.GetContext(ctx, &user, "SELECT "+userColumns+" FROM users WHERE id = $1", userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return &user, err
 }
 
 
-func (s *Storage) AddReviewer(ctx context.Context, tx *sqlx.Tx, prID, userID string) error {
-	_, err := tx.ExecContext(ctx, "INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ($1, $2)", prID, userID)
-	return err
+func (s *Storage) ListUsers(ctx context.Context) ([]entity.User, error) {
+	var users []entity.User
+	err := s.db.SelectContext(ctx, &users, "SELECT "+userColumns+" FROM users ORDER BY id")
+	return users, err
 }
 
 
-func (s *Storage) GetUserReviews(ctx context.Context, userID string) ([]entity.PullRequest, error) {
-	var prs []entity.PullRequest
-	query := `
-		SELECT p.* 
+// FindUsersByUsername lists the users whose username equals the given one,
+// ignoring case.
+func (s *Storage) FindUsersByUsername(ctx context.Context, username string) ([]entity.User, error) {
+	users := make([]entity.User, 0)
+	err := s.db.SelectContext(ctx, &users, "SELECT "+userColumns+" FROM users WHERE LOWER(username) = LOWER($1) ORDER BY id", username)
+	return users, err
+}
+
+
+// CreateUser adds a user without any team.
+func (s *Storage) CreateUser(ctx context.Context, user entity.User) error {
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO users (id, username, is_active, role)
+		VALUES (:id, :username, :is_active, :user_role)
+	`, user)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" {
+				return ErrAlreadyExists
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+
+func (s *Storage) SetUsername(ctx context.Context, tx *sqlx.Tx, userID, username string) error {
+	res, err := tx.ExecContext(ctx, "UPDATE users SET username = $1 WHERE id = $2", username, userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+// EnsureUser creates the user unless one with the same ID exists, which is
+// left as it is. It reports whether the user was created.
+func (s *Storage) EnsureUser(ctx context.Context, tx *sqlx.Tx, user entity.User) (bool, error) {
+	res, err := tx.NamedExecContext(ctx, `
+		INSERT INTO users (id, username, is_active, role)
+		VALUES (:id, :username, :is_active, :user_role)
+		ON CONFLICT (id) DO NOTHING
+	`, user)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := res.RowsAffected()
+	return rows > 0, nil
+}
+
+
+// GetGitHubLogins returns the stored mapping of GitHub logins to user IDs.
+func (s *Storage) GetGitHubLogins(ctx context.Context) (map[string]string, error) {
+	var rows []struct {
+		Login	string 	`db:"login"`
+		UserID	string 	`db:"user_id"`
+	}
+	if err := s.db.SelectContext(ctx, &rows, "SELECT login, user_id FROM github_logins"); err != nil {
+		return nil, err
+	}
+
+	logins := make(map[string]string, len(rows))
+	for _, r := range rows {
+		logins[r.Login] = r.UserID
+	}
+	return logins, nil
+}
+
+
+func (s *Storage) SetGitHubLogin(ctx context.Context, tx *sqlx.Tx, login, userID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO github_logins (login, user_id) VALUES ($1, $2)
+		ON CONFLICT (login) DO UPDATE SET user_id = EXCLUDED.user_id
+	`, login, userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23503" {
+				return ErrNotFound
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+
+// LockUser locks the user row until tx ends.
+func (s *Storage) LockUser(ctx context.Context, tx *sqlx.Tx, userID string) error {
+	var id string
+	err := tx.GetContext(ctx, &id, "SELECT id FROM users WHERE id = $1 FOR UPDATE", userID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+
+// LockUsers locks the existing users among ids and returns their IDs.
+func (s *Storage) LockUsers(ctx context.Context, tx *sqlx.Tx, ids []string) ([]string, error) {
+	locked := make([]string, 0)
+	err := tx.SelectContext(ctx, &locked,
+		"SELECT id FROM users WHERE id = ANY($1) ORDER BY id FOR UPDATE", pq.Array(ids))
+	return locked, err
+}
+
+
+// LockActiveUsers locks the active users among ids and returns their IDs.
+func (s *Storage) LockActiveUsers(ctx context.Context, tx *sqlx.Tx, ids []string) ([]string, error) {
+	active := make([]string, 0)
+	err := tx.SelectContext(ctx, &active,
+		"SELECT id FROM users WHERE id = ANY($1) AND is_active ORDER BY id FOR UPDATE", pq.Array(ids))
+	return active, err
+}
+
+
+// GetUsers returns the existing users among ids.
+func (s *Storage) GetUsers(ctx context.Context, ids []string) ([]entity.User, error) {
+	var users []entity.User
+	err := s.db.SelectContext(ctx, &users, "SELECT "+userColumns+" FROM users WHERE id = ANY($1)", pq.Array(ids))
+	return users, err
+}
+
+
+// MoveMembership moves the user's membership from one team to another,
+// keeping role and weight. With an empty from the user joins as a member.
+func (s *Storage) MoveMembership(ctx context.Context, tx *sqlx.Tx, userID, from, to string) error {
+	if from == "" {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO team_members (team_name, user_id) VALUES ($1, $2)", to, userID)
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE team_members SET team_name = $1, joined_at = NOW() WHERE team_name = $2 AND user_id = $3",
+		to, from, userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+// RemoveMemberships ends all of the user's memberships except the one in
+// keepTeam and returns the teams left.
+func (s *Storage) RemoveMemberships(ctx context.Context, tx *sqlx.Tx, userID, keepTeam string) ([]string, error) {
+	var teams []string
+	err := tx.SelectContext(ctx, &teams,
+		"DELETE FROM team_members WHERE user_id = $1 AND team_name <> $2 RETURNING team_name", userID, keepTeam)
+	return teams, err
+}
+
+
+// MoveAuthoredPRs moves the user's open PRs of team from to team to and
+// returns their IDs.
+func (s *Storage) MoveAuthoredPRs(ctx context.Context, tx *sqlx.Tx, userID, from, to string) ([]string, error) {
+	var prIDs []string
+	err := tx.SelectContext(ctx, &prIDs, `
+		UPDATE pull_requests SET team_name = $1, version = version + 1
+		WHERE author_id = $2 AND team_name = $3 AND status = 'OPEN'
+		RETURNING id
+	`, to, userID, from)
+	return prIDs, err
+}
+
+
+func (s *Storage) SaveTransfer(ctx context.Context, tx *sqlx.Tx, t *entity.TeamTransfer) error {
+	query := `
+		INSERT INTO user_team_transfers (user_id, from_team, to_team, review_policy, pr_policy)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id, created_at
+	`
+	return tx.QueryRowxContext(ctx, query, t.UserID, t.FromTeam, t.ToTeam, t.ReviewPolicy, t.PRPolicy).
+		Scan(&t.ID, &t.CreatedAt)
+}
+
+
+func (s *Storage) GetTransfers(ctx context.Context, userID string) ([]entity.TeamTransfer, error) {
+	var transfers []entity.TeamTransfer
+	query := `
+		SELECT id, user_id, COALESCE(from_team, '') AS from_team, COALESCE(to_team, '') AS to_team,
+			review_policy, pr_policy, created_at
+		FROM user_team_transfers
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+	err := s.db.SelectContext(ctx, &transfers, query, userID)
+	return transfers, err
+}
+
+
+// UpdateMember changes the role and weight of a membership; an empty role or
+// a zero weight keeps the stored one.
+func (s *Storage) UpdateMember(ctx context.Context, m entity.TeamMember) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE team_members SET role = COALESCE(NULLIF($1, ''), role), weight = COALESCE(NULLIF($2, 0), weight)
+		WHERE team_name = $3 AND user_id = $4
+	`, m.TeamRole, m.Weight, m.TeamName, m.ID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+// MarkDeparted deactivates the user and records when they left.
+func (s *Storage) MarkDeparted(ctx context.Context, tx *sqlx.Tx, userID string) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET is_active = FALSE, departed_at = NOW() WHERE id = $1 AND departed_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+// GetAnonymizableIDs returns users that departed before the given time and
+// still have their personal data.
+func (s *Storage) GetAnonymizableIDs(ctx context.Context, departedBefore time.Time) ([]string, error) {
+	var ids []string
+	err := s.db.SelectContext(ctx, &ids,
+		"SELECT id FROM users WHERE departed_at < $1 AND anonymized_at IS NULL ORDER BY departed_at", departedBefore)
+	return ids, err
+}
+
+
+// AnonymizeUser replaces the user's username with pseudonym. The ID stays,
+// so assignments, PRs, history, statistics and references from outside keep
+// pointing at the user. Free-text comments on the user's reassignments and
+// their GitHub logins are dropped.
+func (s *Storage) AnonymizeUser(ctx context.Context, tx *sqlx.Tx, userID, pseudonym string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE pr_reassignments SET comment = '' WHERE old_user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM github_logins WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET username = $2, anonymized_at = NOW()
+		WHERE id = $1 AND departed_at IS NOT NULL AND anonymized_at IS NULL
+	`, userID, pseudonym)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+func (s *Storage) SetUserRole(ctx context.Context, userID, role string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", role, userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+func (s *Storage) SetUserActive(ctx context.Context, tx *sqlx.Tx, userID string, isActive bool) error {
+	res, err := tx.ExecContext(ctx, "UPDATE users SET is_active = $1 WHERE id = $2", isActive, userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+func (s *Storage) GetTeamMembers(ctx context.Context, teamName string) ([]entity.TeamMember, error) {
+	var members []entity.TeamMember
+	err := s.db.SelectContext(ctx, &members, memberSelect+" WHERE tm.team_name = $1 ORDER BY tm.joined_at, u.id", teamName)
+	return members, err
+}
+
+// =====================================================================
+// PULL REQUESTS
+// =====================================================================
+
+
+func (s *Storage) SavePR(ctx context.Context, tx *sqlx.Tx, pr entity.PullRequest) error {
+	query := `
+		INSERT INTO pull_requests (
+			id, name, author_id, status, team_name, version, parent_id, head_sha, review_round, priority, created_at,
+			repository, number, source_branch, target_branch, url, labels, pooled_at
+		)
+		VALUES (
+			:id, :name, :author_id, :status, :team_name, :version, :parent_id, :head_sha, :review_round, :priority, :created_at,
+			:repository, :number, :source_branch, :target_branch, :url, :labels, :pooled_at
+		)
+	`
+	_, err := tx.NamedExecContext(ctx, query, pr)
+
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" {
+				return ErrAlreadyExists
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+
+func (s *Storage) SaveReviewers(ctx context.Context, tx *sqlx.Tx, prID string, reviewerIDs []string, due entity.ReviewDeadline) error {
+	for _, uid := range reviewerIDs {
+		if err := s.AddReviewer(ctx, tx, prID, uid, entity.RoleRequired, due); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authorColumns maps the users row joined as "a" onto PullRequest.Author.
+var authorColumns = `
+		a.id AS "author.id",
+		a.username AS "author.username",
+		a.is_active AS "author.is_active",
+		a.role AS "author.user_role",
+		` + homeTeam("a") + ` AS "author.team_name"`
+
+
+// prColumns selects a pull_requests row as "p". PRs of deleted teams keep
+// their history without a team.
+const prColumns = `
+		p.id, p.name, p.author_id, p.status, COALESCE(p.team_name, '') AS team_name, p.version,
+		p.parent_id, p.head_sha, p.review_round, p.priority, p.created_at, p.merged_at,
+		p.closed_at, p.pooled_at, p.repository, p.number, p.source_branch, p.target_branch,
+		p.url, p.labels`
+
+
+// prSelect loads PRs together with their authors; callers append conditions.
+var prSelect = `
+	SELECT` + prColumns + `,` + authorColumns + `
+	FROM pull_requests p
+	JOIN users a ON a.id = p.author_id
+`
+
+
+// reviewerColumns maps the pr_reviewers row "r" and its users row "u",
+// both LEFT JOINed to "p", onto a nested Reviewer. The columns are never
+// NULL, so a PR without reviewers yields one row with an empty Reviewer.
+var reviewerColumns = `
+		COALESCE(u.id, '') AS "reviewer.id",
+		COALESCE(u.username, '') AS "reviewer.username",
+		COALESCE(u.is_active, FALSE) AS "reviewer.is_active",
+		COALESCE(u.role, '') AS "reviewer.user_role",
+		` + homeTeam("u") + ` AS "reviewer.team_name",
+		COALESCE(r.role, '') AS "reviewer.role",
+		COALESCE(r.state, '') AS "reviewer.review_state",
+		r.approved_sha AS "reviewer.approved_sha",
+		COALESCE(r.assigned_at, p.created_at) AS "reviewer.assigned_at",
+		r.response_due_at AS "reviewer.response_due_at",
+		r.verdict_due_at AS "reviewer.verdict_due_at"`
+
+
+func (s *Storage) GetPR(ctx context.Context, prID string) (*entity.PullRequest, error) {
+	return s.getPR(ctx, s.db, prID, "")
+}
+
+
+// LockPR loads the PR inside tx and holds its row lock until tx ends.
+func (s *Storage) LockPR(ctx context.Context, tx *sqlx.Tx, prID string) (*entity.PullRequest, error) {
+	return s.getPR(ctx, tx, prID, "FOR UPDATE OF p")
+}
+
+
+// getPR loads the PR with its author and reviewers in a single JOIN, one row
+// per reviewer.
+func (s *Storage) getPR(ctx context.Context, q sqlx.QueryerContext, prID, lock string) (*entity.PullRequest, error) {
+	var rows []struct {
+		entity.PullRequest
+		Reviewer entity.Reviewer `db:"reviewer"`
+	}
+	query := `
+		SELECT` + prColumns + `,` + authorColumns + `,` + reviewerColumns + `
 		FROM pull_requests p
+		JOIN users a ON a.id = p.author_id
+		LEFT JOIN pr_reviewers r ON r.pull_request_id = p.id
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE p.id = $1
+		ORDER BY r.assigned_at, u.id
+	` + lock
+
+	if err := sqlx.SelectContext(ctx, q, &rows, query, prID); err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+
+	pr := rows[0].PullRequest
+	pr.Reviewers = []entity.Reviewer{}
+	for _, row := range rows {
+		if row.Reviewer.ID != "" {
+			pr.Reviewers = append(pr.Reviewers, row.Reviewer)
+		}
+	}
+
+	return &pr, nil
+}
+
+
+// attachReviewers fills Reviewers of every given PR with one JOIN query.
+// Lists load their page of PRs first and the reviewers of the whole page
+// here: joining reviewers into the list query would repeat every PR once
+// per reviewer and break LIMIT and cursor pagination.
+func (s *Storage) attachReviewers(ctx context.Context, q sqlx.QueryerContext, prs ...*entity.PullRequest) error {
+	if len(prs) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*entity.PullRequest, len(prs))
+	ids := make([]string, 0, len(prs))
+	for _, pr := range prs {
+		pr.Reviewers = []entity.Reviewer{}
+		byID[pr.ID] = pr
+		ids = append(ids, pr.ID)
+	}
+
+	var rows []struct {
+		PRID string `db:"pull_request_id"`
+		entity.Reviewer
+	}
+	query := `
+		SELECT r.pull_request_id, u.id, u.username, u.is_active, u.role AS user_role,
+			` + homeTeam("u") + ` AS team_name, r.role,
+			r.state AS review_state, r.approved_sha, r.assigned_at,
+			r.response_due_at, r.verdict_due_at
+		FROM pr_reviewers r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.pull_request_id = ANY($1)
+		ORDER BY r.assigned_at, u.id
+	`
+	if err := sqlx.SelectContext(ctx, q, &rows, query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		pr := byID[row.PRID]
+		pr.Reviewers = append(pr.Reviewers, row.Reviewer)
+	}
+	return nil
+}
+
+
+func (s *Storage) attachReviewersToList(ctx context.Context, prs []entity.PullRequest) error {
+	ptrs := make([]*entity.PullRequest, 0, len(prs))
+	for i := range prs {
+		ptrs = append(ptrs, &prs[i])
+	}
+	return s.attachReviewers(ctx, s.db, ptrs...)
+}
+
+func (s *Storage) MergePR(ctx context.Context, tx *sqlx.Tx, prID string) error {
+	query := `
+		UPDATE pull_requests 
+		SET status = 'MERGED', merged_at = NOW(), version = version + 1
+		WHERE id = $1 AND status = 'OPEN'
+	`
+	_, err := tx.ExecContext(ctx, query, prID)
+	return err
+}
+
+
+func (s *Storage) ClosePR(ctx context.Context, tx *sqlx.Tx, prID string) error {
+	query := `
+		UPDATE pull_requests
+		SET status = 'CLOSED', closed_at = NOW(), version = version + 1
+		WHERE id = $1 AND status = 'OPEN'
+	`
+	_, err := tx.ExecContext(ctx, query, prID)
+	return err
+}
+
+
+// SetHeadSHA records a new head commit and opens the next review round.
+func (s *Storage) SetHeadSHA(ctx context.Context, tx *sqlx.Tx, prID, sha string) error {
+	query := `
+		UPDATE pull_requests
+		SET head_sha = $1, review_round = review_round + 1, version = version + 1
+		WHERE id = $2
+	`
+	_, err := tx.ExecContext(ctx, query, sha, prID)
+	return err
+}
+
+
+func (s *Storage) UpdatePR(ctx context.Context, tx *sqlx.Tx, pr entity.PullRequest) error {
+	query := `
+		UPDATE pull_requests SET
+			name = :name,
+			source_branch = :source_branch,
+			target_branch = :target_branch,
+			url = :url,
+			labels = :labels,
+			priority = :priority,
+			version = version + 1
+		WHERE id = :id
+	`
+	_, err := tx.NamedExecContext(ctx, query, pr)
+	return err
+}
+
+
+// ListPRs returns up to f.Limit PRs matching the filter, ordered by f.SortBy
+// and then id, starting right after f.After.
+func (s *Storage) ListPRs(ctx context.Context, f entity.PRFilter) ([]entity.PullRequest, error) {
+	conds := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Status != "" {
+		conds = append(conds, "p.status = "+arg(f.Status))
+	}
+	if f.AuthorID != "" {
+		conds = append(conds, "p.author_id = "+arg(f.AuthorID))
+	}
+	if f.TeamName != "" {
+		conds = append(conds, "p.team_name = "+arg(f.TeamName))
+	}
+	if f.Repository != "" {
+		conds = append(conds, "p.repository = "+arg(f.Repository))
+	}
+	if f.Label != "" {
+		conds = append(conds, "p.labels @> ARRAY["+arg(f.Label)+"]::text[]")
+	}
+	if f.ReviewerID != "" {
+		conds = append(conds, "EXISTS (SELECT 1 FROM pr_reviewers r WHERE r.pull_request_id = p.id AND r.user_id = "+arg(f.ReviewerID)+")")
+	}
+	if f.CreatedFrom != nil {
+		conds = append(conds, "p.created_at >= "+arg(*f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		conds = append(conds, "p.created_at < "+arg(*f.CreatedTo))
+	}
+
+	column, cast := "p.created_at", "::timestamp"
+	if f.SortBy == entity.SortByName {
+		column, cast = "p.name", ""
+	}
+
+	cmp, order := ">", "ASC"
+	if f.Desc {
+		cmp, order = "<", "DESC"
+	}
+
+	if f.After != nil {
+		conds = append(conds, fmt.Sprintf("(%s, p.id) %s (%s%s, %s)", column, cmp, arg(f.After.Value), cast, arg(f.After.ID)))
+	}
+
+	query := prSelect
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, p.id %s LIMIT %s", column, order, order, arg(f.Limit))
+
+	var prs []entity.PullRequest
+	if err := s.db.SelectContext(ctx, &prs, query, args...); err != nil {
+		return nil, err
+	}
+	return prs, s.attachReviewersToList(ctx, prs)
+}
+
+
+// GetStack returns every PR of the stack prID belongs to, from the root down.
+func (s *Storage) GetStack(ctx context.Context, prID string) ([]entity.PullRequest, error) {
+	var prs []entity.PullRequest
+	query := `
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id FROM pull_requests WHERE id = $1
+			UNION ALL
+			SELECT p.id, p.parent_id FROM pull_requests p JOIN up ON p.id = up.parent_id
+		),
+		down AS (
+			SELECT id, 0 AS depth FROM up WHERE parent_id IS NULL
+			UNION ALL
+			SELECT p.id, down.depth + 1 FROM pull_requests p JOIN down ON p.parent_id = down.id
+		)
+		` + prSelect + `
+		JOIN down ON down.id = p.id
+		ORDER BY down.depth, p.created_at
+	`
+	if err := s.db.SelectContext(ctx, &prs, query, prID); err != nil {
+		return nil, err
+	}
+	return prs, s.attachReviewersToList(ctx, prs)
+}
+
+
+// GetDescendantIDs returns the PRs stacked on top of prID, nearest first.
+func (s *Storage) GetDescendantIDs(ctx context.Context, tx *sqlx.Tx, prID string) ([]string, error) {
+	var ids []string
+	query := `
+		WITH RECURSIVE down AS (
+			SELECT id, 1 AS depth FROM pull_requests WHERE parent_id = $1
+			UNION ALL
+			SELECT p.id, down.depth + 1 FROM pull_requests p JOIN down ON p.parent_id = down.id
+		)
+		SELECT id FROM down ORDER BY depth, id
+	`
+	err := tx.SelectContext(ctx, &ids, query, prID)
+	return ids, err
+}
+
+
+func (s *Storage) BumpPRVersion(ctx context.Context, tx *sqlx.Tx, prID string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE pull_requests SET version = version + 1 WHERE id = $1", prID)
+	return err
+}
+
+
+// =====================================================================
+// REASSIGN (Сложная логика)
+// =====================================================================
+
+
+func (s *Storage) RemoveReviewer(ctx context.Context, tx *sqlx.Tx, prID, userID string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM pr_reviewers WHERE pull_request_id=$1 AND user_id=$2", prID, userID)
+	return err
+}
+
+
+func (s *Storage) AddReviewer(ctx context.Context, tx *sqlx.Tx, prID, userID, role string, due entity.ReviewDeadline) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO pr_reviewers (pull_request_id, user_id, role, response_due_at, verdict_due_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, prID, userID, role, due.ResponseDueAt, due.VerdictDueAt)
+	return err
+}
+
+
+// GetOpenReviewIDs lists open PRs the user reviews, only those of teamName
+// unless it is empty.
+func (s *Storage) GetOpenReviewIDs(ctx context.Context, tx *sqlx.Tx, userID, teamName string) ([]string, error) {
+	var prIDs []string
+	query := `
+		SELECT p.id
+		FROM pull_requests p
+		JOIN pr_reviewers r ON p.id = r.pull_request_id
+		WHERE r.user_id = $1 AND p.status = 'OPEN' AND ($2 = '' OR p.team_name = $2)
+		ORDER BY p.created_at
+	`
+	err := tx.SelectContext(ctx, &prIDs, query, userID, teamName)
+	return prIDs, err
+}
+
+
+// CountDeclines counts the user's declines since the given time. Undone
+// declines are not counted.
+func (s *Storage) CountDeclines(ctx context.Context, tx *sqlx.Tx, userID string, since time.Time) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM pr_reassignments
+		WHERE old_user_id = $1 AND declined AND undone_at IS NULL AND created_at > $2
+	`
+	err := tx.GetContext(ctx, &count, query, userID, since)
+	return count, err
+}
+
+
+func (s *Storage) GetReviewerStats(ctx context.Context, userID string, since time.Time) (*entity.ReviewerStats, error) {
+	stats := entity.ReviewerStats{UserID: userID}
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM pr_reviewers r JOIN pull_requests p ON p.id = r.pull_request_id
+				WHERE r.user_id = $1 AND p.status = 'OPEN' AND r.role <> 'shadow') AS open_reviews,
+			(SELECT COUNT(*) FROM pr_reviewers WHERE user_id = $1 AND state = 'APPROVED') AS approvals,
+			(SELECT COUNT(*) FROM pr_reassignments
+				WHERE old_user_id = $1 AND declined AND undone_at IS NULL) AS declines,
+			(SELECT COUNT(*) FROM pr_reassignments
+				WHERE old_user_id = $1 AND declined AND undone_at IS NULL AND created_at > $2) AS declines_last_day
+	`
+	err := s.db.GetContext(ctx, &stats, query, userID, since)
+	return &stats, err
+}
+
+
+// GetReviewLoad counts open reviews of the given users. Shadow assignments
+// are not counted and users without open reviews are not returned.
+func (s *Storage) GetReviewLoad(ctx context.Context, userIDs []string) ([]entity.ReviewLoad, error) {
+	return getReviewLoad(ctx, s.db, userIDs)
+}
+
+
+// GetReviewLoadTx counts open reviews inside tx, including the assignments
+// made earlier in it.
+func (s *Storage) GetReviewLoadTx(ctx context.Context, tx *sqlx.Tx, userIDs []string) ([]entity.ReviewLoad, error) {
+	return getReviewLoad(ctx, tx, userIDs)
+}
+
+
+func getReviewLoad(ctx context.Context, q sqlx.QueryerContext, userIDs []string) ([]entity.ReviewLoad, error) {
+	var load []entity.ReviewLoad
+	query := `
+		SELECT r.user_id, COUNT(*) AS open_reviews
+		FROM pr_reviewers r
+		JOIN pull_requests p ON p.id = r.pull_request_id
+		WHERE p.status = 'OPEN' AND r.role <> 'shadow' AND r.user_id = ANY($1)
+		GROUP BY r.user_id
+	`
+	err := sqlx.SelectContext(ctx, q, &load, query, pq.Array(userIDs))
+	return load, err
+}
+
+
+// RestoreReviewer puts back a previously removed assignment with its state.
+func (s *Storage) RestoreReviewer(ctx context.Context, tx *sqlx.Tx, a entity.PRReviewerPair) error {
+	query := `
+		INSERT INTO pr_reviewers (
+			pull_request_id, user_id, role, state, approved_sha, review_round, assigned_at,
+			responded_at, escalated_at, response_due_at, verdict_due_at
+		)
+		VALUES (
+			:pull_request_id, :user_id, :role, :state, :approved_sha, :review_round, :assigned_at,
+			:responded_at, :escalated_at, :response_due_at, :verdict_due_at
+		)
+	`
+	_, err := tx.NamedExecContext(ctx, query, a)
+	return err
+}
+
+
+func (s *Storage) GetUserReviews(ctx context.Context, userID string) ([]entity.UserReview, error) {
+	var prs []entity.UserReview
+	query := `
+		SELECT` + prColumns + `, r.state AS review_state, r.role AS review_role,` + authorColumns + `
+		FROM pull_requests p
+		JOIN users a ON a.id = p.author_id
 		JOIN pr_reviewers r ON p.id = r.pull_request_id
 		WHERE r.user_id = $1
+		ORDER BY
+			CASE p.priority WHEN 'urgent' THEN 0 WHEN 'normal' THEN 1 ELSE 2 END,
+			p.created_at
+	`
+	if err := s.db.SelectContext(ctx, &prs, query, userID); err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*entity.PullRequest, 0, len(prs))
+	for i := range prs {
+		ptrs = append(ptrs, &prs[i].PullRequest)
+	}
+	return prs, s.attachReviewers(ctx, s.db, ptrs...)
+}
+
+// ListPool returns the team's open PRs that still wait for reviewers to
+// claim them, most urgent and oldest first.
+func (s *Storage) ListPool(ctx context.Context, teamName string) ([]entity.PullRequest, error) {
+	var prs []entity.PullRequest
+	query := prSelect + `
+		WHERE p.team_name = $1 AND p.status = 'OPEN' AND p.pooled_at IS NOT NULL
+		ORDER BY
+			CASE p.priority WHEN 'urgent' THEN 0 WHEN 'normal' THEN 1 ELSE 2 END,
+			p.pooled_at, p.id
+	`
+	if err := s.db.SelectContext(ctx, &prs, query, teamName); err != nil {
+		return nil, err
+	}
+	return prs, s.attachReviewersToList(ctx, prs)
+}
+
+
+func (s *Storage) LeavePool(ctx context.Context, tx *sqlx.Tx, prID string) error {
+	_, err := tx.ExecContext(ctx, "UPDATE pull_requests SET pooled_at = NULL WHERE id = $1", prID)
+	return err
+}
+
+
+// GetExpiredPoolIDs returns pooled PRs that have waited longer than their
+// team's pool timeout.
+func (s *Storage) GetExpiredPoolIDs(ctx context.Context) ([]string, error) {
+	var ids []string
+	query := `
+		SELECT p.id
+		FROM pull_requests p
+		JOIN teams t ON t.name = p.team_name
+		WHERE p.status = 'OPEN'
+		  AND p.pooled_at IS NOT NULL
+		  AND t.archived_at IS NULL
+		  AND t.pool_timeout_minutes > 0
+		  AND p.pooled_at < NOW() - t.pool_timeout_minutes * INTERVAL '1 minute'
+		ORDER BY p.pooled_at
+	`
+	err := s.db.SelectContext(ctx, &ids, query)
+	return ids, err
+}
+
+const reassignmentColumns = `id, pull_request_id, old_user_id, new_user_id, reason, comment, created_at, undone_at, declined`
+
+
+func (s *Storage) SaveReassignment(ctx context.Context, tx *sqlx.Tx, r *entity.Reassignment) error {
+	var previous []byte
+	if r.Previous != nil {
+		var err error
+		if previous, err = json.Marshal(r.Previous); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO pr_reassignments (pull_request_id, old_user_id, new_user_id, reason, comment, declined, previous_assignment)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
 	`
-	err := s.db.SelectContext(ctx, &prs, query, userID)
-	return prs, err
-}
\ No newline at end of file
+	return tx.QueryRowxContext(ctx, query, r.PRID, r.OldUserID, r.NewUserID, r.Reason, r.Comment, r.Declined, previous).
+		Scan(&r.ID, &r.CreatedAt)
+}
+
+
+func (s *Storage) GetReassignments(ctx context.Context, prID string) ([]entity.Reassignment, error) {
+	var history []entity.Reassignment
+	err := s.db.SelectContext(ctx, &history,
+		"SELECT "+reassignmentColumns+" FROM pr_reassignments WHERE pull_request_id = $1 ORDER BY created_at, id", prID)
+	return history, err
+}
+
+
+// GetLastReassignment returns the most recent reassignment on the PR
+// together with the snapshot of the replaced assignment.
+func (s *Storage) GetLastReassignment(ctx context.Context, tx *sqlx.Tx, prID string) (*entity.Reassignment, error) {
+	var row struct {
+		entity.Reassignment
+		Snapshot []byte `db:"previous_assignment"`
+	}
+	query := "SELECT " + reassignmentColumns + ", previous_assignment FROM pr_reassignments " +
+		"WHERE pull_request_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1"
+
+	err := tx.GetContext(ctx, &row, query, prID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := row.Reassignment
+	if len(row.Snapshot) > 0 {
+		r.Previous = &entity.PRReviewerPair{}
+		if err := json.Unmarshal(row.Snapshot, r.Previous); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+
+func (s *Storage) MarkReassignmentUndone(ctx context.Context, tx *sqlx.Tx, id int64) error {
+	_, err := tx.ExecContext(ctx, "UPDATE pr_reassignments SET undone_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+
+// =====================================================================
+// REVIEWS & SLA
+// =====================================================================
+
+
+func (s *Storage) SetReviewState(ctx context.Context, prID, userID, state string, approvedSHA *string) error {
+	query := `
+		UPDATE pr_reviewers
+		SET state = $1,
+			approved_sha = $2,
+			responded_at = COALESCE(responded_at, NOW()),
+			review_round = (SELECT review_round FROM pull_requests WHERE id = $3)
+		WHERE pull_request_id = $3 AND user_id = $4
+	`
+	res, err := s.db.ExecContext(ctx, query, state, approvedSHA, prID, userID)
+	if err != nil {
+		return err
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+
+func (s *Storage) GetReviewAssignments(ctx context.Context, tx *sqlx.Tx, prID string) ([]entity.PRReviewerPair, error) {
+	var assignments []entity.PRReviewerPair
+	err := tx.SelectContext(ctx, &assignments,
+		"SELECT * FROM pr_reviewers WHERE pull_request_id = $1 ORDER BY assigned_at, user_id", prID)
+	return assignments, err
+}
+
+
+// ResetReviews moves reviewers in one of the given states to newState, clears
+// their response and restarts the deadlines of required reviewers. It returns
+// the affected users.
+func (s *Storage) ResetReviews(ctx context.Context, tx *sqlx.Tx, prID string, states []string, newState string, due entity.ReviewDeadline) ([]string, error) {
+	var userIDs []string
+	query := `
+		UPDATE pr_reviewers
+		SET state = $1,
+			responded_at = NULL,
+			escalated_at = NULL,
+			response_due_at = CASE WHEN role = 'required' THEN $2::timestamp END,
+			verdict_due_at = CASE WHEN role = 'required' THEN $3::timestamp END
+		WHERE pull_request_id = $4 AND state = ANY($5)
+		RETURNING user_id
+	`
+	err := tx.SelectContext(ctx, &userIDs, query, newState, due.ResponseDueAt, due.VerdictDueAt, prID, pq.Array(states))
+	return userIDs, err
+}
+
+
+func (s *Storage) GetOverdueReviews(ctx context.Context) ([]entity.OverdueReview, error) {
+	var overdue []entity.OverdueReview
+	query := `
+		SELECT r.pull_request_id, r.user_id, p.author_id, p.team_name, t.sla_policy
+		FROM pr_reviewers r
+		JOIN pull_requests p ON p.id = r.pull_request_id
+		JOIN teams t ON t.name = p.team_name
+		WHERE p.status = 'OPEN'
+		  AND r.role = 'required'
+		  AND r.escalated_at IS NULL
+		  AND (
+			(r.responded_at IS NULL AND r.response_due_at < NOW())
+			OR (r.state NOT IN ('APPROVED', 'CHANGES_REQUESTED') AND r.verdict_due_at < NOW())
+		  )
+		ORDER BY r.assigned_at
+	`
+	err := s.db.SelectContext(ctx, &overdue, query)
+	return overdue, err
+}
+
+
+func (s *Storage) MarkEscalated(ctx context.Context, prID, userID string) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE pr_reviewers SET escalated_at = NOW() WHERE pull_request_id = $1 AND user_id = $2",
+		prID, userID)
+	return err
+}
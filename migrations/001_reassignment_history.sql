@@ -0,0 +1,16 @@
+-- Adds the history of reviewer reassignments.
+CREATE TABLE IF NOT EXISTS pr_reassignments (
+    id              BIGSERIAL    PRIMARY KEY,
+    pull_request_id VARCHAR(255) NOT NULL,
+    old_user_id     VARCHAR(255) NOT NULL,
+    new_user_id     VARCHAR(255) NOT NULL,
+    reason          VARCHAR(50)  NOT NULL,
+    comment         TEXT         NOT NULL DEFAULT '',
+    created_at      TIMESTAMP    NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_reassign_pr FOREIGN KEY (pull_request_id) REFERENCES pull_requests(id) ON DELETE CASCADE,
+    CONSTRAINT fk_reassign_old FOREIGN KEY (old_user_id) REFERENCES users(id) ON DELETE RESTRICT,
+    CONSTRAINT fk_reassign_new FOREIGN KEY (new_user_id) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS idx_reassignments_pr ON pr_reassignments (pull_request_id, created_at);
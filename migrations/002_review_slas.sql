@@ -0,0 +1,14 @@
+-- Adds per-team review SLAs and the review state of each reviewer. Reviewers
+-- assigned before have no deadlines.
+ALTER TABLE teams
+    ADD COLUMN IF NOT EXISTS first_response_sla_minutes INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS verdict_sla_minutes INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS sla_policy VARCHAR(20) NOT NULL DEFAULT 'notify';
+
+ALTER TABLE pr_reviewers
+    ADD COLUMN IF NOT EXISTS state VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+    ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS responded_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS response_due_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS verdict_due_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP;
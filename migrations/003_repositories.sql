@@ -0,0 +1,39 @@
+-- Adds repository metadata to PRs and per-repository team settings. PRs now
+-- belong to a team; existing ones get their author's team.
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS reviewers_count INTEGER NOT NULL DEFAULT 2;
+
+ALTER TABLE pull_requests
+    ADD COLUMN IF NOT EXISTS repository VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS number INTEGER,
+    ADD COLUMN IF NOT EXISTS source_branch VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS target_branch VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS url TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS labels TEXT[] NOT NULL DEFAULT '{}';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'pull_requests' AND column_name = 'team_name'
+    ) THEN
+        ALTER TABLE pull_requests ADD COLUMN team_name VARCHAR(255);
+
+        UPDATE pull_requests pr SET team_name = u.team_name
+        FROM users u
+        WHERE u.id = pr.author_id;
+
+        ALTER TABLE pull_requests ALTER COLUMN team_name SET NOT NULL,
+            ADD CONSTRAINT fk_pr_team FOREIGN KEY (team_name) REFERENCES teams(name) ON DELETE RESTRICT,
+            ADD CONSTRAINT uq_repository_number UNIQUE (repository, number);
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS team_repository_settings (
+    team_name       VARCHAR(255) NOT NULL,
+    repository      VARCHAR(255) NOT NULL,
+    reviewers_count INTEGER,
+
+    PRIMARY KEY (team_name, repository),
+
+    CONSTRAINT fk_repo_team FOREIGN KEY (team_name) REFERENCES teams(name) ON DELETE CASCADE
+);
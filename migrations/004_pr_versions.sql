@@ -0,0 +1,2 @@
+-- Adds PR versions for optimistic concurrency.
+ALTER TABLE pull_requests ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+-- Adds stacked PRs.
+ALTER TABLE pull_requests ADD COLUMN IF NOT EXISTS parent_id VARCHAR(255)
+    CONSTRAINT fk_parent REFERENCES pull_requests(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_pull_requests_parent ON pull_requests (parent_id);
@@ -0,0 +1,12 @@
+-- Adds review rounds, approvals bound to a head SHA and required approvals.
+ALTER TABLE teams
+    ADD COLUMN IF NOT EXISTS required_approvals INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS stale_approvals VARCHAR(20) NOT NULL DEFAULT 'dismiss';
+
+ALTER TABLE pull_requests
+    ADD COLUMN IF NOT EXISTS head_sha VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS review_round INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE pr_reviewers
+    ADD COLUMN IF NOT EXISTS approved_sha VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS review_round INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,6 @@
+-- Adds PR priorities and assignment strategies.
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS assignment_strategy VARCHAR(20) NOT NULL DEFAULT 'random';
+
+ALTER TABLE pull_requests ADD COLUMN IF NOT EXISTS priority VARCHAR(10) NOT NULL DEFAULT 'normal';
+
+ALTER TABLE team_repository_settings ADD COLUMN IF NOT EXISTS assignment_strategy VARCHAR(20);
@@ -0,0 +1,4 @@
+-- Adds undo of reassignments.
+ALTER TABLE pr_reassignments
+    ADD COLUMN IF NOT EXISTS undone_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS previous_assignment JSONB;
@@ -0,0 +1,12 @@
+-- migrate: no transaction
+-- Indexes for /pullRequest/list filters and keyset pagination, built without
+-- blocking writes. A build that fails leaves an invalid index behind, which
+-- has to be dropped before the server retries.
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pull_requests_created ON pull_requests (created_at, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pull_requests_name ON pull_requests (name, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pull_requests_status_created ON pull_requests (status, created_at, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pull_requests_author_created ON pull_requests (author_id, created_at, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pull_requests_team_created ON pull_requests (team_name, created_at, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pull_requests_repository_created ON pull_requests (repository, created_at, id);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pull_requests_labels ON pull_requests USING GIN (labels);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_pr_reviewers_user ON pr_reviewers (user_id, pull_request_id);
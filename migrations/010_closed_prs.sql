@@ -0,0 +1,2 @@
+-- Adds closing PRs without a merge.
+ALTER TABLE pull_requests ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
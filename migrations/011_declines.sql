@@ -0,0 +1,4 @@
+-- Adds reviewer declines.
+ALTER TABLE pr_reassignments ADD COLUMN IF NOT EXISTS declined BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_reassignments_declines ON pr_reassignments (old_user_id, created_at) WHERE declined;
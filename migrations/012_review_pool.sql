@@ -0,0 +1,8 @@
+-- Adds the review pool mode.
+ALTER TABLE teams
+    ADD COLUMN IF NOT EXISTS assignment_mode VARCHAR(20) NOT NULL DEFAULT 'auto',
+    ADD COLUMN IF NOT EXISTS pool_timeout_minutes INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE pull_requests ADD COLUMN IF NOT EXISTS pooled_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_pull_requests_pool ON pull_requests (team_name, pooled_at) WHERE pooled_at IS NOT NULL;
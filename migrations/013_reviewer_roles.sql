@@ -0,0 +1,6 @@
+-- Adds optional and shadow reviewers and onboarding users.
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS shadow_share_percent INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_onboarding BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE pr_reviewers ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'required';
@@ -0,0 +1,11 @@
+-- Lets teams be renamed, with references to them following the new name, and
+-- users be removed from their team.
+ALTER TABLE users ALTER COLUMN team_name DROP NOT NULL,
+    DROP CONSTRAINT IF EXISTS fk_team,
+    ADD CONSTRAINT fk_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE RESTRICT;
+
+ALTER TABLE pull_requests DROP CONSTRAINT IF EXISTS fk_pr_team,
+    ADD CONSTRAINT fk_pr_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE RESTRICT;
+
+ALTER TABLE team_repository_settings DROP CONSTRAINT IF EXISTS fk_repo_team,
+    ADD CONSTRAINT fk_repo_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+-- Adds archived teams. PRs of a deleted team are left without one.
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+ALTER TABLE pull_requests ALTER COLUMN team_name DROP NOT NULL,
+    DROP CONSTRAINT IF EXISTS fk_pr_team,
+    ADD CONSTRAINT fk_pr_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL;
@@ -0,0 +1,16 @@
+-- Adds the history of user transfers between teams.
+CREATE TABLE IF NOT EXISTS user_team_transfers (
+    id              BIGSERIAL    PRIMARY KEY,
+    user_id         VARCHAR(255) NOT NULL,
+    from_team       VARCHAR(255),
+    to_team         VARCHAR(255),
+    review_policy   VARCHAR(20)  NOT NULL,
+    pr_policy       VARCHAR(20)  NOT NULL,
+    created_at      TIMESTAMP    NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_transfer_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT,
+    CONSTRAINT fk_transfer_from FOREIGN KEY (from_team) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT fk_transfer_to FOREIGN KEY (to_team) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfers_user ON user_team_transfers (user_id, created_at);
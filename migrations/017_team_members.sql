@@ -0,0 +1,24 @@
+-- Moves team membership from users.team_name and users.is_onboarding into
+-- team_members, so that a user may belong to several teams.
+CREATE TABLE IF NOT EXISTS team_members (
+    team_name   VARCHAR(255) NOT NULL,
+    user_id     VARCHAR(255) NOT NULL,
+    role        VARCHAR(20)  NOT NULL DEFAULT 'member',
+    weight      INTEGER      NOT NULL DEFAULT 1,
+    joined_at   TIMESTAMP    NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (team_name, user_id),
+
+    CONSTRAINT fk_member_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE RESTRICT,
+    CONSTRAINT fk_member_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_members_user ON team_members (user_id, joined_at);
+
+INSERT INTO team_members (team_name, user_id, role)
+SELECT team_name, id, CASE WHEN is_onboarding THEN 'onboarding' ELSE 'member' END
+FROM users
+WHERE team_name IS NOT NULL
+ON CONFLICT (team_name, user_id) DO NOTHING;
+
+ALTER TABLE users DROP COLUMN team_name, DROP COLUMN is_onboarding;
@@ -0,0 +1,5 @@
+-- Adds the team hierarchy.
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS parent_team VARCHAR(255)
+    CONSTRAINT fk_parent_team REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_teams_parent ON teams (parent_team);
@@ -0,0 +1,2 @@
+-- Adds user roles (member, lead, bot); existing users become members.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member';
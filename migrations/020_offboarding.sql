@@ -0,0 +1,6 @@
+-- Adds offboarding.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS departed_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_departed ON users (departed_at) WHERE departed_at IS NOT NULL AND anonymized_at IS NULL;
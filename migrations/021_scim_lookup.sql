@@ -0,0 +1,3 @@
+-- Indexes for SCIM filters on userName, displayName and group names.
+CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
+CREATE INDEX IF NOT EXISTS idx_teams_name_lower ON teams (LOWER(name));
@@ -0,0 +1,7 @@
+-- Adds the GitHub login mapping used by the org importer.
+CREATE TABLE IF NOT EXISTS github_logins (
+    login       VARCHAR(255) PRIMARY KEY,
+    user_id     VARCHAR(255) NOT NULL,
+
+    CONSTRAINT fk_github_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
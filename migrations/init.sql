@@ -1,14 +1,61 @@
 CREATE TABLE IF NOT EXISTS teams (
-    name        VARCHAR(255) PRIMARY KEY
+    name                        VARCHAR(255) PRIMARY KEY,
+    archived_at                 TIMESTAMP,
+    first_response_sla_minutes  INTEGER      NOT NULL DEFAULT 0,
+    verdict_sla_minutes         INTEGER      NOT NULL DEFAULT 0,
+    sla_policy                  VARCHAR(20)  NOT NULL DEFAULT 'notify',
+    reviewers_count             INTEGER      NOT NULL DEFAULT 2,
+    required_approvals          INTEGER      NOT NULL DEFAULT 0,
+    stale_approvals             VARCHAR(20)  NOT NULL DEFAULT 'dismiss',
+    assignment_strategy         VARCHAR(20)  NOT NULL DEFAULT 'random',
+    assignment_mode             VARCHAR(20)  NOT NULL DEFAULT 'auto',
+    pool_timeout_minutes        INTEGER      NOT NULL DEFAULT 0,
+    shadow_share_percent        INTEGER      NOT NULL DEFAULT 0,
+    parent_team                 VARCHAR(255),
+
+    CONSTRAINT fk_parent_team FOREIGN KEY (parent_team) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL
 );
 
+CREATE INDEX IF NOT EXISTS idx_teams_parent ON teams (parent_team);
+CREATE INDEX IF NOT EXISTS idx_teams_name_lower ON teams (LOWER(name));
+
 
 CREATE TABLE IF NOT EXISTS users (
     id          VARCHAR(255) PRIMARY KEY,
     username    VARCHAR(255) NOT NULL,
     is_active   BOOLEAN      NOT NULL DEFAULT TRUE,
+    role        VARCHAR(20)  NOT NULL DEFAULT 'member',
+    departed_at     TIMESTAMP,
+    anonymized_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
+CREATE INDEX IF NOT EXISTS idx_users_departed ON users (departed_at) WHERE departed_at IS NOT NULL AND anonymized_at IS NULL;
+
+
+-- A user may belong to several teams; the earliest membership is their home team.
+CREATE TABLE IF NOT EXISTS team_members (
     team_name   VARCHAR(255) NOT NULL,
-    CONSTRAINT fk_team FOREIGN KEY (team_name) REFERENCES teams(name) ON DELETE RESTRICT
+    user_id     VARCHAR(255) NOT NULL,
+    role        VARCHAR(20)  NOT NULL DEFAULT 'member',
+    weight      INTEGER      NOT NULL DEFAULT 1,
+    joined_at   TIMESTAMP    NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (team_name, user_id),
+
+    CONSTRAINT fk_member_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE RESTRICT,
+    CONSTRAINT fk_member_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_members_user ON team_members (user_id, joined_at);
+
+
+-- Maps GitHub logins, stored lowercased, to internal user IDs for the org importer.
+CREATE TABLE IF NOT EXISTS github_logins (
+    login       VARCHAR(255) PRIMARY KEY,
+    user_id     VARCHAR(255) NOT NULL,
+
+    CONSTRAINT fk_github_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
 
@@ -17,19 +64,130 @@ CREATE TABLE IF NOT EXISTS pull_requests (
     name        VARCHAR(255) NOT NULL,
     author_id   VARCHAR(255) NOT NULL,
     status      VARCHAR(20)  NOT NULL DEFAULT 'OPEN',
+    team_name   VARCHAR(255),
+    version     INTEGER      NOT NULL DEFAULT 1,
+    parent_id   VARCHAR(255),
+    head_sha    VARCHAR(64)  NOT NULL DEFAULT '',
+    review_round INTEGER     NOT NULL DEFAULT 1,
+    priority    VARCHAR(10)  NOT NULL DEFAULT 'normal',
     created_at  TIMESTAMP    DEFAULT NOW(),
     merged_at   TIMESTAMP,
+    closed_at   TIMESTAMP,
+    pooled_at   TIMESTAMP,
+
+    repository      VARCHAR(255) NOT NULL DEFAULT '',
+    number          INTEGER,
+    source_branch   VARCHAR(255) NOT NULL DEFAULT '',
+    target_branch   VARCHAR(255) NOT NULL DEFAULT '',
+    url             TEXT         NOT NULL DEFAULT '',
+    labels          TEXT[]       NOT NULL DEFAULT '{}',
 
-    CONSTRAINT fk_author FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE RESTRICT
+    CONSTRAINT fk_author FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE RESTRICT,
+    CONSTRAINT fk_pr_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT fk_parent FOREIGN KEY (parent_id) REFERENCES pull_requests(id) ON DELETE SET NULL,
+    CONSTRAINT uq_repository_number UNIQUE (repository, number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pull_requests_parent ON pull_requests (parent_id);
+CREATE INDEX IF NOT EXISTS idx_pull_requests_pool ON pull_requests (team_name, pooled_at) WHERE pooled_at IS NOT NULL;
+
+
+CREATE TABLE IF NOT EXISTS team_repository_settings (
+    team_name       VARCHAR(255) NOT NULL,
+    repository      VARCHAR(255) NOT NULL,
+    reviewers_count INTEGER,
+    assignment_strategy VARCHAR(20),
+
+    PRIMARY KEY (team_name, repository),
+
+    CONSTRAINT fk_repo_team FOREIGN KEY (team_name) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
 
 CREATE TABLE IF NOT EXISTS pr_reviewers (
     pull_request_id VARCHAR(255) NOT NULL,
     user_id         VARCHAR(255) NOT NULL,
+    role            VARCHAR(20)  NOT NULL DEFAULT 'required',
+    state           VARCHAR(20)  NOT NULL DEFAULT 'PENDING',
+    approved_sha    VARCHAR(64),
+    review_round    INTEGER      NOT NULL DEFAULT 1,
+    assigned_at     TIMESTAMP    NOT NULL DEFAULT NOW(),
+    responded_at    TIMESTAMP,
+    response_due_at TIMESTAMP,
+    verdict_due_at  TIMESTAMP,
+    escalated_at    TIMESTAMP,
     
     PRIMARY KEY (pull_request_id, user_id),
 
     CONSTRAINT fk_pr FOREIGN KEY (pull_request_id) REFERENCES pull_requests(id) ON DELETE CASCADE,
     CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT
 );
+
+
+CREATE TABLE IF NOT EXISTS pr_reassignments (
+    id              BIGSERIAL    PRIMARY KEY,
+    pull_request_id VARCHAR(255) NOT NULL,
+    old_user_id     VARCHAR(255) NOT NULL,
+    new_user_id     VARCHAR(255) NOT NULL,
+    reason          VARCHAR(50)  NOT NULL,
+    comment         TEXT         NOT NULL DEFAULT '',
+    created_at      TIMESTAMP    NOT NULL DEFAULT NOW(),
+    undone_at       TIMESTAMP,
+    declined        BOOLEAN      NOT NULL DEFAULT FALSE,
+    previous_assignment JSONB,
+
+    CONSTRAINT fk_reassign_pr FOREIGN KEY (pull_request_id) REFERENCES pull_requests(id) ON DELETE CASCADE,
+    CONSTRAINT fk_reassign_old FOREIGN KEY (old_user_id) REFERENCES users(id) ON DELETE RESTRICT,
+    CONSTRAINT fk_reassign_new FOREIGN KEY (new_user_id) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+CREATE TABLE IF NOT EXISTS user_team_transfers (
+    id              BIGSERIAL    PRIMARY KEY,
+    user_id         VARCHAR(255) NOT NULL,
+    from_team       VARCHAR(255),
+    to_team         VARCHAR(255),
+    review_policy   VARCHAR(20)  NOT NULL,
+    pr_policy       VARCHAR(20)  NOT NULL,
+    created_at      TIMESTAMP    NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT fk_transfer_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT,
+    CONSTRAINT fk_transfer_from FOREIGN KEY (from_team) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT fk_transfer_to FOREIGN KEY (to_team) REFERENCES teams(name) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_transfers_user ON user_team_transfers (user_id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_reassignments_pr ON pr_reassignments (pull_request_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_reassignments_declines ON pr_reassignments (old_user_id, created_at) WHERE declined;
+
+
+-- The numbered migrations whose changes this file already includes. The rest,
+-- such as the concurrent index builds, are applied by the server on start.
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    name        VARCHAR(255) PRIMARY KEY,
+    applied_at  TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO schema_migrations (name) VALUES
+    ('001_reassignment_history.sql'),
+    ('002_review_slas.sql'),
+    ('003_repositories.sql'),
+    ('004_pr_versions.sql'),
+    ('005_stacked_prs.sql'),
+    ('006_review_rounds.sql'),
+    ('007_priorities.sql'),
+    ('008_reassignment_undo.sql'),
+    ('010_closed_prs.sql'),
+    ('011_declines.sql'),
+    ('012_review_pool.sql'),
+    ('013_reviewer_roles.sql'),
+    ('014_team_rename.sql'),
+    ('015_team_archive.sql'),
+    ('016_team_transfers.sql'),
+    ('017_team_members.sql'),
+    ('018_parent_teams.sql'),
+    ('019_user_roles.sql'),
+    ('020_offboarding.sql'),
+    ('021_scim_lookup.sql'),
+    ('022_github_logins.sql')
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,10 @@
+// Package migrations holds the database schema. init.sql creates it from
+// scratch on an empty database and records the numbered migrations it already
+// includes; the server applies the others in order when it starts, which
+// brings databases created by any earlier version up to date.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
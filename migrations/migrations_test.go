@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+
+// Every migration is either recorded in init.sql or left to the server, as
+// concurrent index builds are.
+func TestInitRecordsMigrations(t *testing.T) {
+	initSQL, err := FS.ReadFile("init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := fs.Glob(FS, "[0-9]*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		script, err := FS.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorded := strings.Contains(string(initSQL), "('"+name+"')")
+		concurrent := strings.HasPrefix(string(script), "-- migrate: no transaction")
+		if recorded == concurrent {
+			t.Errorf("%s: recorded in init.sql = %v, runs without a transaction = %v", name, recorded, concurrent)
+		}
+	}
+}
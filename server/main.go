@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 
+	"ex8ed/pullreq-assigner/internal/entity"
+	"ex8ed/pullreq-assigner/internal/github"
 	"ex8ed/pullreq-assigner/internal/handler"
 	"ex8ed/pullreq-assigner/internal/service"
 	"ex8ed/pullreq-assigner/internal/storage"
@@ -31,10 +35,87 @@ func main() {
 		log.Fatal("Could not connect to DB:", err)
 	}
 
+	declineLimit := 3
+	if v := os.Getenv("DECLINE_DAILY_LIMIT"); v != "" {
+		if declineLimit, err = strconv.Atoi(v); err != nil {
+			log.Fatal("Invalid DECLINE_DAILY_LIMIT:", err)
+		}
+	}
+
+	transferReviewPolicy := entity.MemberReviewsReassign
+	switch v := os.Getenv("TRANSFER_REVIEW_POLICY"); v {
+	case "":
+	case entity.MemberReviewsKeep, entity.MemberReviewsReassign:
+		transferReviewPolicy = v
+	default:
+		log.Fatal("Invalid TRANSFER_REVIEW_POLICY:", v)
+	}
+
+	transferPRPolicy := entity.AuthoredPRsKeep
+	switch v := os.Getenv("TRANSFER_PR_POLICY"); v {
+	case "":
+	case entity.AuthoredPRsKeep, entity.AuthoredPRsMove:
+		transferPRPolicy = v
+	default:
+		log.Fatal("Invalid TRANSFER_PR_POLICY:", v)
+	}
+
+	botPRPolicy := entity.BotPRsAssign
+	switch v := os.Getenv("BOT_PR_POLICY"); v {
+	case "":
+	case entity.BotPRsAssign, entity.BotPRsPool, entity.BotPRsNone:
+		botPRPolicy = v
+	default:
+		log.Fatal("Invalid BOT_PR_POLICY:", v)
+	}
+
+	undoWindow := 15 * time.Minute
+	if v := os.Getenv("REASSIGN_UNDO_WINDOW"); v != "" {
+		if undoWindow, err = time.ParseDuration(v); err != nil {
+			log.Fatal("Invalid REASSIGN_UNDO_WINDOW:", err)
+		}
+	}
+
+	anonymizeAfter := 90 * 24 * time.Hour
+	if v := os.Getenv("ANONYMIZE_AFTER"); v != "" {
+		if anonymizeAfter, err = time.ParseDuration(v); err != nil {
+			log.Fatal("Invalid ANONYMIZE_AFTER:", err)
+		}
+	}
+
+	// The GitHub import is enabled by GITHUB_TOKEN or GITHUB_API_URL; the
+	// latter points it at GitHub Enterprise or a fake server, which may need
+	// no token.
+	var gitHub service.GitHubSource
+	token, apiURL := os.Getenv("GITHUB_TOKEN"), os.Getenv("GITHUB_API_URL")
+	if token != "" || apiURL != "" {
+		gitHub = github.NewClient(apiURL, token)
+	}
+
 	repo := storage.New(db)
-	svc := service.New(repo)
+	if err := repo.Migrate(context.Background()); err != nil {
+		log.Fatal("Could not migrate DB:", err)
+	}
+	svc := service.New(repo, service.Config{
+		UndoWindow:           undoWindow,
+		DeclineDailyLimit:    declineLimit,
+		TransferReviewPolicy: transferReviewPolicy,
+		TransferPRPolicy:     transferPRPolicy,
+		BotPRPolicy:          botPRPolicy,
+		BotPRTeam:            os.Getenv("BOT_PR_TEAM"),
+		AnonymizeAfter:       anonymizeAfter,
+		GitHub:               gitHub,
+	})
 	h := handler.New(svc)
 
+	interval := time.Minute
+	if v := os.Getenv("SCHEDULER_INTERVAL"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("Invalid SCHEDULER_INTERVAL:", err)
+		}
+	}
+	go svc.RunScheduler(context.Background(), interval)
+
 	mux := http.NewServeMux()
 
 	// Health
@@ -43,15 +124,58 @@ func main() {
 	// Teams
 	mux.HandleFunc("/team/add", h.CreateTeam)
 	mux.HandleFunc("/team/get", h.GetTeam)
+	mux.HandleFunc("/team/settings", h.UpdateTeamSettings)
+	mux.HandleFunc("/team/repositorySettings", h.SaveRepositorySettings)
+	mux.HandleFunc("/team/addMembers", h.AddTeamMembers)
+	mux.HandleFunc("/team/updateMember", h.UpdateTeamMember)
+	mux.HandleFunc("/team/removeMember", h.RemoveTeamMember)
+	mux.HandleFunc("/team/rename", h.RenameTeam)
+	mux.HandleFunc("/team/setParent", h.SetTeamParent)
+	mux.HandleFunc("/team/archive", h.ArchiveTeam)
+	mux.HandleFunc("/team/unarchive", h.UnarchiveTeam)
+	mux.HandleFunc("/team/delete", h.DeleteTeam)
 
 	// Users
 	mux.HandleFunc("/users/setIsActive", h.SetUserActive)
+	mux.HandleFunc("/users/setRole", h.SetUserRole)
+	mux.HandleFunc("/users/setOnboarding", h.SetUserOnboarding)
+	mux.HandleFunc("/users/offboard", h.OffboardUser)
+	mux.HandleFunc("/users/setGitHubLogin", h.SetGitHubLogin)
+	mux.HandleFunc("/users/transfer", h.TransferUser)
+	mux.HandleFunc("/users/transfers", h.GetTransfers)
 	mux.HandleFunc("/users/getReview", h.GetUserReviews)
+	mux.HandleFunc("/users/stats", h.GetReviewerStats)
 
 	// Pull Requests
 	mux.HandleFunc("/pullRequest/create", h.CreatePR)
+	mux.HandleFunc("/pullRequest/get", h.GetPR)
+	mux.HandleFunc("/pullRequest/update", h.UpdatePR)
 	mux.HandleFunc("/pullRequest/merge", h.MergePR)
+	mux.HandleFunc("/pullRequest/close", h.ClosePR)
+	mux.HandleFunc("/pullRequest/bulk", h.BulkPR)
 	mux.HandleFunc("/pullRequest/reassign", h.ReassignReviewer)
+	mux.HandleFunc("/pullRequest/reassign/undo", h.UndoReassignment)
+	mux.HandleFunc("/pullRequest/decline", h.DeclineReview)
+	mux.HandleFunc("/pullRequest/addReviewer", h.AddReviewer)
+	mux.HandleFunc("/pullRequest/push", h.PushCommit)
+	mux.HandleFunc("/pullRequest/review", h.SubmitReview)
+	mux.HandleFunc("/pullRequest/history", h.GetReassignments)
+	mux.HandleFunc("/pullRequest/stack", h.GetStack)
+	mux.HandleFunc("/pullRequest/list", h.ListPRs)
+
+	// Pool
+	mux.HandleFunc("/pool/list", h.ListPool)
+	mux.HandleFunc("/pool/claim", h.ClaimPR)
+
+	// Org sync
+	mux.HandleFunc("/org/sync", h.SyncOrg)
+	mux.HandleFunc("/org/importGitHub", h.ImportGitHubOrg)
+
+	// SCIM provisioning
+	mux.HandleFunc("/scim/v2/Users", h.SCIMUsers)
+	mux.HandleFunc("/scim/v2/Users/", h.SCIMUsers)
+	mux.HandleFunc("/scim/v2/Groups", h.SCIMGroups)
+	mux.HandleFunc("/scim/v2/Groups/", h.SCIMGroups)
 
 	log.Println("Server starting on :8080")
 	if err := http.ListenAndServe(":8080", mux); err != nil {
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"testing"
 	"time"
 )
@@ -84,4 +86,2419 @@ func TestHappyPath(t *testing.T) {
 	if resp.StatusCode != http.StatusOK {
 		t.Errorf("Merge failed: %d", resp.StatusCode)
 	}
-}
\ No newline at end of file
+}
+
+func TestReassignToChosenUser(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	t.Log("Step 1: Creating Team")
+	teamPayload := fmt.Sprintf(`{"team_name": "reassigners-%[1]d", "members": [
+		{"user_id": "ra-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "rb-%[1]d", "username": "Bob", "is_active": true},
+		{"user_id": "rc-%[1]d", "username": "Charlie", "is_active": true},
+		{"user_id": "rd-%[1]d", "username": "Dave", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+
+	t.Log("Step 2: Creating PR")
+	prID := fmt.Sprintf("pr-reassign-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Refactor", "author_id": "ra-%d"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prResp struct {
+		PR struct {
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&prResp)
+	resp.Body.Close()
+
+	if len(prResp.PR.Reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %d", len(prResp.PR.Reviewers))
+	}
+
+	assigned := map[string]bool{fmt.Sprintf("ra-%d", suffix): true}
+	for _, u := range prResp.PR.Reviewers {
+		assigned[u.ID] = true
+	}
+
+	var free string
+	for _, id := range []string{"rb", "rc", "rd"} {
+		if uid := fmt.Sprintf("%s-%d", id, suffix); !assigned[uid] {
+			free = uid
+		}
+	}
+
+	t.Log("Step 3: Reassigning to chosen user")
+	oldID := prResp.PR.Reviewers[0].ID
+	reassignPayload := fmt.Sprintf(`{"pull_request_id": "%s", "old_user_id": "%s", "new_user_id": "%s", "reason": "workload"}`, prID, oldID, free)
+
+	resp, err = client.Post(baseURL+"/pullRequest/reassign", "application/json", bytes.NewBuffer([]byte(reassignPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reassignResp struct {
+		ReplacedBy string `json:"replaced_by"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reassignResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Reassign failed: %d", resp.StatusCode)
+	}
+	if reassignResp.ReplacedBy != free {
+		t.Errorf("Expected replacement %s, got %s", free, reassignResp.ReplacedBy)
+	}
+
+	t.Log("Step 4: Checking history")
+	resp, err = client.Get(baseURL + "/pullRequest/history?pull_request_id=" + prID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var historyResp struct {
+		Reassignments []struct {
+			OldUserID string `json:"old_user_id"`
+			NewUserID string `json:"new_user_id"`
+			Reason    string `json:"reason"`
+		} `json:"reassignments"`
+	}
+	json.NewDecoder(resp.Body).Decode(&historyResp)
+	resp.Body.Close()
+
+	if len(historyResp.Reassignments) != 1 {
+		t.Fatalf("Expected 1 history entry, got %d", len(historyResp.Reassignments))
+	}
+	if got := historyResp.Reassignments[0]; got.OldUserID != oldID || got.NewUserID != free || got.Reason != "workload" {
+		t.Errorf("Unexpected history entry: %+v", got)
+	}
+}
+
+
+func TestDeactivationReassignsReviews(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	post := func(path, payload string) *http.Response {
+		resp, err := client.Post(baseURL+path, "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		return resp
+	}
+
+	t.Log("Step 1: Creating a team where Dave is inactive")
+	teamPayload := fmt.Sprintf(`{"team_name": "apps-%[1]d", "members": [
+		{"user_id": "xa-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "xx-%[1]d", "username": "Xena", "is_active": true},
+		{"user_id": "xd-%[1]d", "username": "Dave", "is_active": false}
+	]}`, suffix)
+
+	resp := post("/team/add", teamPayload)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Team creation failed: %d", resp.StatusCode)
+	}
+
+	t.Log("Step 2: Xena reviews Alice's PR, then Alice and Xena review Dave's PR")
+	for _, author := range []string{"xa", "xd"} {
+		if author == "xd" {
+			resp = post("/users/setIsActive", fmt.Sprintf(`{"user_id": "xd-%d", "is_active": true}`, suffix))
+			resp.Body.Close()
+		}
+
+		resp = post("/pullRequest/create", fmt.Sprintf(`{"pull_request_id": "deact-%[2]s-%[1]d", "pull_request_name": "Fix", "author_id": "%[2]s-%[1]d"}`, suffix, author))
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Failed to create PR: status %d", resp.StatusCode)
+		}
+	}
+
+	t.Log("Step 3: Deactivating Xena with reassignment")
+	resp = post("/users/setIsActive", fmt.Sprintf(`{"user_id": "xx-%d", "is_active": false, "reassign_reviews": true}`, suffix))
+
+	var deactivateResp struct {
+		User struct {
+			IsActive bool `json:"is_active"`
+		} `json:"user"`
+		Reassigned []struct {
+			PRID      string `json:"pull_request_id"`
+			NewUserID string `json:"new_user_id"`
+		} `json:"reassigned"`
+		NotReassigned []string `json:"not_reassigned"`
+	}
+	json.NewDecoder(resp.Body).Decode(&deactivateResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Deactivation failed: %d", resp.StatusCode)
+	}
+	if deactivateResp.User.IsActive {
+		t.Errorf("Expected Xena to be inactive")
+	}
+	if len(deactivateResp.Reassigned) != 1 || deactivateResp.Reassigned[0].PRID != fmt.Sprintf("deact-xa-%d", suffix) ||
+		deactivateResp.Reassigned[0].NewUserID != fmt.Sprintf("xd-%d", suffix) {
+		t.Errorf("Expected Alice's PR moved to Dave, got %+v", deactivateResp.Reassigned)
+	}
+	if len(deactivateResp.NotReassigned) != 1 || deactivateResp.NotReassigned[0] != fmt.Sprintf("deact-xd-%d", suffix) {
+		t.Errorf("Expected Dave's PR without a candidate, got %v", deactivateResp.NotReassigned)
+	}
+
+	t.Log("Step 4: Checking the open reviews of Xena and Dave")
+	for reviewer, want := range map[string]string{"xd": "deact-xa", "xx": "deact-xd"} {
+		resp, err := client.Get(fmt.Sprintf("%s/users/getReview?user_id=%s-%d", baseURL, reviewer, suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var reviewsResp struct {
+			PullRequests []struct {
+				ID string `json:"pull_request_id"`
+			} `json:"pull_requests"`
+		}
+		json.NewDecoder(resp.Body).Decode(&reviewsResp)
+		resp.Body.Close()
+
+		if len(reviewsResp.PullRequests) != 1 || reviewsResp.PullRequests[0].ID != fmt.Sprintf("%s-%d", want, suffix) {
+			t.Errorf("Expected %s-%d reviewed by %s, got %+v", want, suffix, reviewer, reviewsResp.PullRequests)
+		}
+	}
+}
+
+
+func TestRepositoryPRIdentity(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "repos-%[1]d", "members": [
+		{"user_id": "ra-%[1]d", "username": "Alice", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	t.Log("Step 1: Same number in two repositories")
+	ids := map[string]bool{}
+	for _, repository := range []string{"api", "web"} {
+		prPayload := fmt.Sprintf(`{"repository": "acme/%[2]s-%[1]d", "number": 7, "pull_request_name": "Fix", "author_id": "ra-%[1]d"}`, suffix, repository)
+
+		resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var prResp struct {
+			PR PR `json:"pr"`
+		}
+		json.NewDecoder(resp.Body).Decode(&prResp)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Failed to create PR in %s: status %d", repository, resp.StatusCode)
+		}
+		ids[prResp.PR.ID] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected distinct IDs for the two repositories, got %v", ids)
+	}
+
+	t.Log("Step 2: Rejecting duplicates and IDs outside the repository")
+	for payload, want := range map[string]int{
+		fmt.Sprintf(`{"repository": "acme/api-%[1]d", "number": 7, "pull_request_name": "Again", "author_id": "ra-%[1]d"}`, suffix):                               http.StatusConflict,
+		fmt.Sprintf(`{"pull_request_id": "other-%[1]d", "repository": "acme/api-%[1]d", "number": 8, "pull_request_name": "Fix", "author_id": "ra-%[1]d"}`, suffix): http.StatusBadRequest,
+		fmt.Sprintf(`{"pull_request_id": "acme/api-%[1]d#9", "pull_request_name": "Fix", "author_id": "ra-%[1]d"}`, suffix):                                        http.StatusBadRequest,
+	} {
+		resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != want {
+			t.Errorf("Expected %d for %s, got %d", want, payload, resp.StatusCode)
+		}
+	}
+
+
+	t.Log("Step 3: Reading a PR by repository and number")
+	resp, err = client.Get(fmt.Sprintf("%s/pullRequest/get?repository=%s&number=7", baseURL, url.QueryEscape(fmt.Sprintf("acme/web-%d", suffix))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var getResp struct {
+		PR struct {
+			Repository string `json:"repository"`
+			Number     int    `json:"number"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&getResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || getResp.PR.Repository != fmt.Sprintf("acme/web-%d", suffix) || getResp.PR.Number != 7 {
+		t.Errorf("Unexpected PR: status %d, %+v", resp.StatusCode, getResp.PR)
+	}
+}
+
+
+func TestUpdatePRVersionConflict(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "editors-%[1]d", "members": [
+		{"user_id": "ea-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "eb-%[1]d", "username": "Bob", "is_active": true},
+		{"user_id": "ec-%[1]d", "username": "Carol", "is_active": true},
+		{"user_id": "ed-%[1]d", "username": "Dave", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	prID := fmt.Sprintf("pr-update-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Draft", "author_id": "ea-%d"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var createResp struct {
+		PR struct {
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&createResp)
+	resp.Body.Close()
+
+	if len(createResp.PR.Reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %v", createResp.PR.Reviewers)
+	}
+
+	t.Log("Step 1: Updating with current version")
+	updatePayload := fmt.Sprintf(`{"pull_request_id": "%s", "version": 1, "pull_request_name": "Ready", "labels": ["backend"]}`, prID)
+
+	resp, err = client.Post(baseURL+"/pullRequest/update", "application/json", bytes.NewBuffer([]byte(updatePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var updateResp struct {
+		PR struct {
+			Name    string `json:"pull_request_name"`
+			Version int    `json:"version"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&updateResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Update failed: %d", resp.StatusCode)
+	}
+	if updateResp.PR.Name != "Ready" || updateResp.PR.Version != 2 {
+		t.Errorf("Unexpected PR after update: %+v", updateResp.PR)
+	}
+
+	t.Log("Step 2: Updating with stale version")
+	resp, err = client.Post(baseURL+"/pullRequest/update", "application/json", bytes.NewBuffer([]byte(updatePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conflictResp struct {
+		CurrentVersion int `json:"current_version"`
+	}
+	json.NewDecoder(resp.Body).Decode(&conflictResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("Expected 409, got %d", resp.StatusCode)
+	}
+	if conflictResp.CurrentVersion != 2 {
+		t.Errorf("Expected current version 2, got %d", conflictResp.CurrentVersion)
+	}
+
+	// staleUpdate expects an update at version to fail with the current one.
+	staleUpdate := func(version, current int) {
+		payload := fmt.Sprintf(`{"pull_request_id": "%s", "version": %d, "pull_request_name": "Stale"}`, prID, version)
+
+		resp, err := client.Post(baseURL+"/pullRequest/update", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var conflictResp struct {
+			CurrentVersion int `json:"current_version"`
+		}
+		json.NewDecoder(resp.Body).Decode(&conflictResp)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusConflict || conflictResp.CurrentVersion != current {
+			t.Errorf("Expected 409 with current version %d, got %d and %d", current, resp.StatusCode, conflictResp.CurrentVersion)
+		}
+	}
+
+	t.Log("Step 3: Reassigning a reviewer bumps the version")
+	reassignPayload := fmt.Sprintf(`{"pull_request_id": "%s", "old_user_id": "%s"}`, prID, createResp.PR.Reviewers[0].ID)
+
+	resp, err = client.Post(baseURL+"/pullRequest/reassign", "application/json", bytes.NewBuffer([]byte(reassignPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Reassign failed: %d", resp.StatusCode)
+	}
+	staleUpdate(2, 3)
+
+	t.Log("Step 4: Merging bumps the version")
+	resp, err = client.Post(baseURL+"/pullRequest/merge", "application/json", bytes.NewBuffer([]byte(fmt.Sprintf(`{"pull_request_id": "%s"}`, prID))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Merge failed: %d", resp.StatusCode)
+	}
+	staleUpdate(3, 4)
+}
+
+
+func TestStackedPRs(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "stackers-%[1]d", "members": [
+		{"user_id": "sa-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "sb-%[1]d", "username": "Bob", "is_active": true},
+		{"user_id": "sc-%[1]d", "username": "Carol", "is_active": true},
+		{"user_id": "sd-%[1]d", "username": "Dave", "is_active": true},
+		{"user_id": "se-%[1]d", "username": "Erin", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	t.Log("Step 1: Creating a stack of three PRs")
+	ids := []string{fmt.Sprintf("stack-%d-0", suffix), fmt.Sprintf("stack-%d-1", suffix), fmt.Sprintf("stack-%d-2", suffix)}
+	reviewers := make([][]string, len(ids))
+
+	for i, id := range ids {
+		parent := ""
+		if i > 0 {
+			parent = fmt.Sprintf(`, "parent_id": "%s"`, ids[i-1])
+		}
+		prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Part %d", "author_id": "sa-%d"%s}`, id, i, suffix, parent)
+
+		resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var prResp struct {
+			PR struct {
+				Reviewers []User `json:"assigned_reviewers"`
+			} `json:"pr"`
+		}
+		json.NewDecoder(resp.Body).Decode(&prResp)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated || len(prResp.PR.Reviewers) != 2 {
+			t.Fatalf("Failed to create PR %d: status %d, reviewers %+v", i, resp.StatusCode, prResp.PR.Reviewers)
+		}
+		for _, u := range prResp.PR.Reviewers {
+			reviewers[i] = append(reviewers[i], u.ID)
+		}
+		sort.Strings(reviewers[i])
+	}
+
+	for i := 1; i < len(ids); i++ {
+		if fmt.Sprint(reviewers[i]) != fmt.Sprint(reviewers[0]) {
+			t.Errorf("Expected PR %d to inherit %v, got %v", i, reviewers[0], reviewers[i])
+		}
+	}
+
+	t.Log("Step 2: Reassigning on the base PR down the stack")
+	assigned := map[string]bool{fmt.Sprintf("sa-%d", suffix): true}
+	for _, id := range reviewers[0] {
+		assigned[id] = true
+	}
+
+	var free string
+	for _, name := range []string{"sb", "sc", "sd", "se"} {
+		if id := fmt.Sprintf("%s-%d", name, suffix); !assigned[id] {
+			free = id
+		}
+	}
+
+	old := reviewers[0][0]
+	reassignPayload := fmt.Sprintf(`{"pull_request_id": "%s", "old_user_id": "%s", "new_user_id": "%s",
+		"reason": "workload", "propagate": true}`, ids[0], old, free)
+
+	resp, err = client.Post(baseURL+"/pullRequest/reassign", "application/json", bytes.NewBuffer([]byte(reassignPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reassignResp struct {
+		ReplacedBy string `json:"replaced_by"`
+		Propagated []struct {
+			PRID      string `json:"pull_request_id"`
+			NewUserID string `json:"new_user_id"`
+		} `json:"propagated"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reassignResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || reassignResp.ReplacedBy != free {
+		t.Fatalf("Reassign failed: status %d, replaced by %q", resp.StatusCode, reassignResp.ReplacedBy)
+	}
+	if len(reassignResp.Propagated) != 2 {
+		t.Fatalf("Expected the reassignment propagated to 2 PRs, got %+v", reassignResp.Propagated)
+	}
+	for _, p := range reassignResp.Propagated {
+		if p.NewUserID != free {
+			t.Errorf("Expected %s on %s, got %s", free, p.PRID, p.NewUserID)
+		}
+	}
+
+	t.Log("Step 3: Merging the base PR and reading the stack")
+	mergePayload := fmt.Sprintf(`{"pull_request_id": "%s"}`, ids[0])
+
+	resp, err = client.Post(baseURL+"/pullRequest/merge", "application/json", bytes.NewBuffer([]byte(mergePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Merge failed: %d", resp.StatusCode)
+	}
+
+	resp, err = client.Get(baseURL + "/pullRequest/stack?pull_request_id=" + ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stackResp struct {
+		Stack []struct {
+			ID        string `json:"pull_request_id"`
+			Status    string `json:"status"`
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"stack"`
+	}
+	json.NewDecoder(resp.Body).Decode(&stackResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(stackResp.Stack) != 3 {
+		t.Fatalf("Unexpected stack: status %d, %+v", resp.StatusCode, stackResp.Stack)
+	}
+	for i, pr := range stackResp.Stack {
+		want := "OPEN"
+		if i == 0 {
+			want = "MERGED"
+		}
+		if pr.ID != ids[i] || pr.Status != want {
+			t.Errorf("Expected %s %s at position %d, got %s %s", ids[i], want, i, pr.ID, pr.Status)
+		}
+		for _, u := range pr.Reviewers {
+			if u.ID == old {
+				t.Errorf("Expected %s replaced on %s", old, pr.ID)
+			}
+		}
+	}
+}
+
+
+func TestReReviewAfterPush(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "gatekeepers-%[1]d",
+		"settings": {"required_approvals": 2, "stale_approvals": "dismiss"},
+		"members": [
+			{"user_id": "ga-%[1]d", "username": "Alice", "is_active": true},
+			{"user_id": "gb-%[1]d", "username": "Bob", "is_active": true},
+			{"user_id": "gc-%[1]d", "username": "Carol", "is_active": true}
+		]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	prID := fmt.Sprintf("rr-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Fix", "author_id": "ga-%d", "head_sha": "a1"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Failed to create PR: status %d", resp.StatusCode)
+	}
+
+	review := func(user, state, sha string) {
+		payload := fmt.Sprintf(`{"pull_request_id": "%s", "user_id": "%s-%d", "state": "%s", "commit_sha": "%s"}`, prID, user, suffix, state, sha)
+
+		resp, err := client.Post(baseURL+"/pullRequest/review", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Review %s by %s failed: %d", state, user, resp.StatusCode)
+		}
+	}
+
+	merge := func() (int, string) {
+		payload := fmt.Sprintf(`{"pull_request_id": "%s"}`, prID)
+
+		resp, err := client.Post(baseURL+"/pullRequest/merge", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var errResp struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return resp.StatusCode, errResp.Error.Code
+	}
+
+	t.Log("Step 1: One approval is not enough")
+	review("gb", "APPROVED", "")
+	review("gc", "CHANGES_REQUESTED", "")
+
+	if status, code := merge(); status != http.StatusConflict || code != "NOT_APPROVED" {
+		t.Errorf("Expected 409 NOT_APPROVED, got %d %q", status, code)
+	}
+
+	t.Log("Step 2: Pushing a new commit starts a new round")
+	pushPayload := fmt.Sprintf(`{"pull_request_id": "%s", "head_sha": "b2"}`, prID)
+
+	resp, err = client.Post(baseURL+"/pullRequest/push", "application/json", bytes.NewBuffer([]byte(pushPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pushResp struct {
+		PR struct {
+			HeadSHA     string `json:"head_sha"`
+			ReviewRound int    `json:"review_round"`
+		} `json:"pr"`
+		ReReview []string `json:"re_review_required"`
+	}
+	json.NewDecoder(resp.Body).Decode(&pushResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Push failed: %d", resp.StatusCode)
+	}
+	if pushResp.PR.HeadSHA != "b2" || pushResp.PR.ReviewRound != 2 {
+		t.Errorf("Expected head b2 in round 2, got %+v", pushResp.PR)
+	}
+	sort.Strings(pushResp.ReReview)
+	if fmt.Sprint(pushResp.ReReview) != fmt.Sprint([]string{fmt.Sprintf("gb-%d", suffix), fmt.Sprintf("gc-%d", suffix)}) {
+		t.Errorf("Expected both reviewers sent back, got %v", pushResp.ReReview)
+	}
+
+	resp, err = client.Get(fmt.Sprintf("%s/users/getReview?user_id=gb-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reviewsResp struct {
+		PullRequests []struct {
+			ID          string `json:"pull_request_id"`
+			ReviewState string `json:"review_state"`
+			OwesReview  bool   `json:"owes_review"`
+		} `json:"pull_requests"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reviewsResp)
+	resp.Body.Close()
+
+	if len(reviewsResp.PullRequests) != 1 || reviewsResp.PullRequests[0].ReviewState != "STALE" || !reviewsResp.PullRequests[0].OwesReview {
+		t.Errorf("Expected Bob's stale approval to owe a review, got %+v", reviewsResp.PullRequests)
+	}
+
+	t.Log("Step 3: Approvals of the old commit do not count")
+	review("gb", "APPROVED", "b2")
+	review("gc", "APPROVED", "a1")
+
+	if status, code := merge(); status != http.StatusConflict || code != "NOT_APPROVED" {
+		t.Errorf("Expected 409 NOT_APPROVED with an outdated approval, got %d %q", status, code)
+	}
+
+	t.Log("Step 4: Approvals of the head commit allow the merge")
+	review("gc", "APPROVED", "")
+
+	if status, code := merge(); status != http.StatusOK {
+		t.Errorf("Expected the merge to pass, got %d %q", status, code)
+	}
+}
+
+
+func TestUrgentPriority(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "oncall-%[1]d",
+		"settings": {"reviewers_count": 1, "first_response_sla_minutes": 60},
+		"members": [
+			{"user_id": "ua-%[1]d", "username": "Alice", "is_active": true},
+			{"user_id": "ub-%[1]d", "username": "Bob", "is_active": true},
+			{"user_id": "uc-%[1]d", "username": "Carol", "is_active": true}
+		]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	type reviewer struct {
+		ID            string    `json:"user_id"`
+		AssignedAt    time.Time `json:"assigned_at"`
+		ResponseDueAt time.Time `json:"response_due_at"`
+	}
+
+	create := func(id, priority string) reviewer {
+		prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Fix", "author_id": "ua-%d", "priority": "%s"}`, id, suffix, priority)
+
+		resp, err := client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var prResp struct {
+			PR struct {
+				Priority  string     `json:"priority"`
+				Reviewers []reviewer `json:"assigned_reviewers"`
+			} `json:"pr"`
+		}
+		json.NewDecoder(resp.Body).Decode(&prResp)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated || prResp.PR.Priority != priority || len(prResp.PR.Reviewers) != 1 {
+			t.Fatalf("Failed to create %s PR: status %d, %+v", priority, resp.StatusCode, prResp.PR)
+		}
+		return prResp.PR.Reviewers[0]
+	}
+
+	t.Log("Step 1: Rejecting an unknown priority")
+	badPayload := fmt.Sprintf(`{"pull_request_id": "up-bad-%[1]d", "pull_request_name": "Fix", "author_id": "ua-%[1]d", "priority": "asap"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(badPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown priority, got %d", resp.StatusCode)
+	}
+
+	t.Log("Step 2: Urgent PR goes to the least loaded reviewer with a shorter deadline")
+	normalID, urgentID := fmt.Sprintf("up-normal-%d", suffix), fmt.Sprintf("up-urgent-%d", suffix)
+
+	normal := create(normalID, "normal")
+	urgent := create(urgentID, "urgent")
+
+	if urgent.ID == normal.ID {
+		t.Errorf("Expected the urgent PR to skip %s, who already has a review", normal.ID)
+	}
+	if d := normal.ResponseDueAt.Sub(normal.AssignedAt); d < 59*time.Minute || d > 61*time.Minute {
+		t.Errorf("Expected a 60 minute deadline for the normal PR, got %v", d)
+	}
+	if d := urgent.ResponseDueAt.Sub(urgent.AssignedAt); d < 14*time.Minute || d > 16*time.Minute {
+		t.Errorf("Expected a 15 minute deadline for the urgent PR, got %v", d)
+	}
+
+	t.Log("Step 3: Urgent PRs come first in the review list")
+	reassignPayload := fmt.Sprintf(`{"pull_request_id": "%s", "old_user_id": "%s", "new_user_id": "%s"}`, urgentID, urgent.ID, normal.ID)
+
+	resp, err = client.Post(baseURL+"/pullRequest/reassign", "application/json", bytes.NewBuffer([]byte(reassignPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Reassign failed: %d", resp.StatusCode)
+	}
+
+	resp, err = client.Get(fmt.Sprintf("%s/users/getReview?user_id=%s", baseURL, normal.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reviewsResp struct {
+		PullRequests []struct {
+			ID string `json:"pull_request_id"`
+		} `json:"pull_requests"`
+	}
+	json.NewDecoder(resp.Body).Decode(&reviewsResp)
+	resp.Body.Close()
+
+	if len(reviewsResp.PullRequests) != 2 || reviewsResp.PullRequests[0].ID != urgentID || reviewsResp.PullRequests[1].ID != normalID {
+		t.Errorf("Expected the urgent PR first, got %+v", reviewsResp.PullRequests)
+	}
+}
+
+
+func TestUndoReassignment(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "undoers-%[1]d", "members": [
+		{"user_id": "na-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "nb-%[1]d", "username": "Bob", "is_active": true},
+		{"user_id": "nc-%[1]d", "username": "Carol", "is_active": true},
+		{"user_id": "nd-%[1]d", "username": "Dave", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	prID := fmt.Sprintf("undo-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Fix", "author_id": "na-%d"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prResp struct {
+		PR struct {
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&prResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || len(prResp.PR.Reviewers) != 2 {
+		t.Fatalf("Failed to create PR: status %d, reviewers %+v", resp.StatusCode, prResp.PR.Reviewers)
+	}
+
+	original := prResp.PR.Reviewers[0].ID
+	assigned := map[string]bool{fmt.Sprintf("na-%d", suffix): true}
+	for _, u := range prResp.PR.Reviewers {
+		assigned[u.ID] = true
+	}
+
+	var free string
+	for _, name := range []string{"nb", "nc", "nd"} {
+		if id := fmt.Sprintf("%s-%d", name, suffix); !assigned[id] {
+			free = id
+		}
+	}
+
+	undoPayload := fmt.Sprintf(`{"pull_request_id": "%s"}`, prID)
+
+	undo := func() (int, string) {
+		resp, err := client.Post(baseURL+"/pullRequest/reassign/undo", "application/json", bytes.NewBuffer([]byte(undoPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var undoResp struct {
+			Restored string `json:"restored"`
+			Removed  string `json:"removed"`
+			Error    struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&undoResp)
+
+		if resp.StatusCode == http.StatusOK && (undoResp.Restored != original || undoResp.Removed != free) {
+			t.Errorf("Expected %s restored and %s removed, got %+v", original, free, undoResp)
+		}
+		return resp.StatusCode, undoResp.Error.Code
+	}
+
+	t.Log("Step 1: Nothing to undo yet")
+	if status, code := undo(); status != http.StatusConflict || code != "UNDO_UNAVAILABLE" {
+		t.Errorf("Expected 409 UNDO_UNAVAILABLE, got %d %q", status, code)
+	}
+
+	t.Log("Step 2: Reassigning an approved review by mistake")
+	reviewPayload := fmt.Sprintf(`{"pull_request_id": "%s", "user_id": "%s", "state": "APPROVED"}`, prID, original)
+
+	resp, err = client.Post(baseURL+"/pullRequest/review", "application/json", bytes.NewBuffer([]byte(reviewPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	reassignPayload := fmt.Sprintf(`{"pull_request_id": "%s", "old_user_id": "%s", "new_user_id": "%s", "reason": "other"}`, prID, original, free)
+
+	resp, err = client.Post(baseURL+"/pullRequest/reassign", "application/json", bytes.NewBuffer([]byte(reassignPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Reassign failed: %d", resp.StatusCode)
+	}
+
+	t.Log("Step 3: Undoing restores the reviewer with their approval")
+	if status, code := undo(); status != http.StatusOK {
+		t.Fatalf("Undo failed: %d %q", status, code)
+	}
+
+	reviews := func(userID string) map[string]string {
+		resp, err := client.Get(fmt.Sprintf("%s/users/getReview?user_id=%s", baseURL, userID))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var reviewsResp struct {
+			PullRequests []struct {
+				ID          string `json:"pull_request_id"`
+				ReviewState string `json:"review_state"`
+			} `json:"pull_requests"`
+		}
+		json.NewDecoder(resp.Body).Decode(&reviewsResp)
+		resp.Body.Close()
+
+		states := make(map[string]string)
+		for _, pr := range reviewsResp.PullRequests {
+			states[pr.ID] = pr.ReviewState
+		}
+		return states
+	}
+
+	if state, ok := reviews(original)[prID]; !ok || state != "APPROVED" {
+		t.Errorf("Expected %s back with the approval, got %q", original, state)
+	}
+	if _, ok := reviews(free)[prID]; ok {
+		t.Errorf("Expected %s removed from the PR", free)
+	}
+
+	t.Log("Step 4: The same reassignment cannot be undone twice")
+	if status, code := undo(); status != http.StatusConflict || code != "UNDO_UNAVAILABLE" {
+		t.Errorf("Expected 409 UNDO_UNAVAILABLE, got %d %q", status, code)
+	}
+}
+
+
+func TestListPRsPagination(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+	repository := fmt.Sprintf("acme/list-%d", suffix)
+
+	teamPayload := fmt.Sprintf(`{"team_name": "listers-%[1]d", "members": [
+		{"user_id": "la-%[1]d", "username": "Alice", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	t.Log("Step 1: Creating PRs")
+	for i := 1; i <= 3; i++ {
+		prPayload := fmt.Sprintf(`{"repository": "%s", "number": %d, "pull_request_name": "Change %d", "author_id": "la-%d"}`, repository, i, i, suffix)
+
+		resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Failed to create PR: status %d", resp.StatusCode)
+		}
+	}
+
+	type page struct {
+		PullRequests []PR   `json:"pull_requests"`
+		NextCursor   string `json:"next_cursor"`
+	}
+
+	fetch := func(cursor string) page {
+		resp, err := client.Get(fmt.Sprintf("%s/pullRequest/list?repository=%s&limit=2&cursor=%s", baseURL, repository, cursor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("List failed: %d", resp.StatusCode)
+		}
+
+		var p page
+		json.NewDecoder(resp.Body).Decode(&p)
+		return p
+	}
+
+	t.Log("Step 2: Fetching pages")
+	first := fetch("")
+	if len(first.PullRequests) != 2 || first.NextCursor == "" {
+		t.Fatalf("Expected 2 PRs and a cursor, got %d and %q", len(first.PullRequests), first.NextCursor)
+	}
+
+	second := fetch(first.NextCursor)
+	if len(second.PullRequests) != 1 || second.NextCursor != "" {
+		t.Fatalf("Expected 1 PR and no cursor, got %d and %q", len(second.PullRequests), second.NextCursor)
+	}
+
+	seen := map[string]bool{}
+	for _, pr := range append(first.PullRequests, second.PullRequests...) {
+		if seen[pr.ID] {
+			t.Errorf("PR %s returned twice", pr.ID)
+		}
+		seen[pr.ID] = true
+	}
+
+	t.Log("Step 3: Reusing the cursor with another sort")
+	resp, err = client.Get(fmt.Sprintf("%s/pullRequest/list?repository=%s&limit=2&sort=name&cursor=%s", baseURL, repository, first.NextCursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a cursor of another sort, got %d", resp.StatusCode)
+	}
+}
+
+
+func TestGetPRDetails(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "details-%[1]d", "members": [
+		{"user_id": "da-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "db-%[1]d", "username": "Bob", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	soloPayload := fmt.Sprintf(`{"team_name": "solo-%[1]d", "members": [
+		{"user_id": "dc-%[1]d", "username": "Carol", "is_active": true}
+	]}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(soloPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for _, author := range []string{"da", "dc"} {
+		prPayload := fmt.Sprintf(`{"pull_request_id": "det-%[2]s-%[1]d", "pull_request_name": "Fix", "author_id": "%[2]s-%[1]d"}`, suffix, author)
+
+		resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Failed to create PR of %s: status %d", author, resp.StatusCode)
+		}
+	}
+
+	type detail struct {
+		PR struct {
+			Status string `json:"status"`
+			Author struct {
+				ID       string `json:"user_id"`
+				Username string `json:"username"`
+				TeamName string `json:"team_name"`
+			} `json:"author"`
+			Reviewers []struct {
+				ID          string `json:"user_id"`
+				Username    string `json:"username"`
+				IsActive    bool   `json:"is_active"`
+				TeamName    string `json:"team_name"`
+				Role        string `json:"role"`
+				ReviewState string `json:"review_state"`
+			} `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+
+	t.Log("Step 1: Reading a PR with full reviewer and author records")
+	resp, err = client.Get(fmt.Sprintf("%s/pullRequest/get?pull_request_id=det-da-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got detail
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Get failed: %d", resp.StatusCode)
+	}
+	if got.PR.Status != "OPEN" || got.PR.Author.Username != "Alice" || got.PR.Author.TeamName != fmt.Sprintf("details-%d", suffix) {
+		t.Errorf("Unexpected PR or author: %+v", got.PR)
+	}
+	if len(got.PR.Reviewers) != 1 {
+		t.Fatalf("Expected Bob as the only reviewer, got %+v", got.PR.Reviewers)
+	}
+	r := got.PR.Reviewers[0]
+	if r.ID != fmt.Sprintf("db-%d", suffix) || r.Username != "Bob" || !r.IsActive ||
+		r.TeamName != fmt.Sprintf("details-%d", suffix) || r.Role != "required" || r.ReviewState == "" {
+		t.Errorf("Reviewer is not fully loaded: %+v", r)
+	}
+
+	t.Log("Step 2: Reading a PR without reviewers")
+	resp, err = client.Get(fmt.Sprintf("%s/pullRequest/get?pull_request_id=det-dc-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw map[string]map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&raw)
+	resp.Body.Close()
+
+	if reviewers, ok := raw["pr"]["assigned_reviewers"].([]interface{}); resp.StatusCode != http.StatusOK || !ok || len(reviewers) != 0 {
+		t.Errorf("Expected an empty reviewer list, got status %d, %v", resp.StatusCode, raw["pr"]["assigned_reviewers"])
+	}
+
+	t.Log("Step 3: Unknown and missing IDs")
+	resp, err = client.Get(fmt.Sprintf("%s/pullRequest/get?pull_request_id=missing-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown PR, got %d", resp.StatusCode)
+	}
+
+	resp, err = client.Get(baseURL + "/pullRequest/get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without an ID, got %d", resp.StatusCode)
+	}
+}
+
+func TestBulkAtomicRollback(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "release-%[1]d", "members": [
+		{"user_id": "ra-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "rb-%[1]d", "username": "Bob", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	prID := fmt.Sprintf("pr-bulk-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Release", "author_id": "ra-%d"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	t.Log("Step 1: Atomic bulk with a missing PR")
+	bulkPayload := fmt.Sprintf(`{"atomic": true, "operations": [
+		{"op": "merge", "pull_request_id": "%s"},
+		{"op": "close", "pull_request_id": "missing-%d"}
+	]}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/bulk", "application/json", bytes.NewBuffer([]byte(bulkPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bulkResp struct {
+		Committed bool `json:"committed"`
+		Results   []struct {
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		} `json:"results"`
+	}
+	json.NewDecoder(resp.Body).Decode(&bulkResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Bulk failed: %d", resp.StatusCode)
+	}
+	if bulkResp.Committed || len(bulkResp.Results) != 2 {
+		t.Fatalf("Unexpected bulk response: %+v", bulkResp)
+	}
+	if bulkResp.Results[0].Error.Code != "ROLLED_BACK" || bulkResp.Results[1].Error.Code != "NOT_FOUND" {
+		t.Errorf("Unexpected error codes: %+v", bulkResp.Results)
+	}
+
+	t.Log("Step 2: PR must still be open")
+	resp, err = client.Get(baseURL + "/pullRequest/get?pull_request_id=" + prID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var getResp struct {
+		PR struct {
+			Status string `json:"status"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&getResp)
+	resp.Body.Close()
+
+	if getResp.PR.Status != "OPEN" {
+		t.Errorf("Expected OPEN after rollback, got %s", getResp.PR.Status)
+	}
+}
+
+
+func TestBulkBestEffort(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "hotfix-%[1]d", "members": [
+		{"user_id": "ha-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "hb-%[1]d", "username": "Bob", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	mergeID := fmt.Sprintf("pr-merge-%d", suffix)
+	closeID := fmt.Sprintf("pr-close-%d", suffix)
+	for _, id := range []string{mergeID, closeID} {
+		prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Hotfix", "author_id": "ha-%d"}`, id, suffix)
+
+		resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	t.Log("Step 1: Best-effort bulk with a missing PR in the middle")
+	bulkPayload := fmt.Sprintf(`{"atomic": false, "operations": [
+		{"op": "merge", "pull_request_id": "%s"},
+		{"op": "close", "pull_request_id": "missing-%d"},
+		{"op": "close", "pull_request_id": "%s"}
+	]}`, mergeID, suffix, closeID)
+
+	resp, err = client.Post(baseURL+"/pullRequest/bulk", "application/json", bytes.NewBuffer([]byte(bulkPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bulkResp struct {
+		Committed bool `json:"committed"`
+		Results   []struct {
+			Status int `json:"status"`
+			PR     struct {
+				Status string `json:"status"`
+			} `json:"pr"`
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		} `json:"results"`
+	}
+	json.NewDecoder(resp.Body).Decode(&bulkResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Bulk failed: %d", resp.StatusCode)
+	}
+	if !bulkResp.Committed || len(bulkResp.Results) != 3 {
+		t.Fatalf("Unexpected bulk response: %+v", bulkResp)
+	}
+	if bulkResp.Results[0].Status != http.StatusOK || bulkResp.Results[0].PR.Status != "MERGED" {
+		t.Errorf("Expected the first PR merged, got %+v", bulkResp.Results[0])
+	}
+	if bulkResp.Results[1].Error.Code != "NOT_FOUND" {
+		t.Errorf("Expected NOT_FOUND for the missing PR, got %+v", bulkResp.Results[1])
+	}
+	if bulkResp.Results[2].Status != http.StatusOK || bulkResp.Results[2].PR.Status != "CLOSED" {
+		t.Errorf("Expected the last PR closed, got %+v", bulkResp.Results[2])
+	}
+
+	t.Log("Step 2: The successful operations stay applied")
+	for id, want := range map[string]string{mergeID: "MERGED", closeID: "CLOSED"} {
+		resp, err = client.Get(baseURL + "/pullRequest/get?pull_request_id=" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var getResp struct {
+			PR struct {
+				Status string `json:"status"`
+			} `json:"pr"`
+		}
+		json.NewDecoder(resp.Body).Decode(&getResp)
+		resp.Body.Close()
+
+		if getResp.PR.Status != want {
+			t.Errorf("Expected %s to be %s, got %s", id, want, getResp.PR.Status)
+		}
+	}
+}
+
+
+func TestDeclineDailyLimit(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	// The server runs with the default DECLINE_DAILY_LIMIT of 3.
+	teamPayload := fmt.Sprintf(`{"team_name": "decliners-%[1]d", "members": [
+		{"user_id": "da-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "dd-%[1]d", "username": "Dave", "is_active": true},
+		{"user_id": "dx-%[1]d", "username": "Xena", "is_active": true},
+		{"user_id": "dy-%[1]d", "username": "Yuri", "is_active": true},
+		{"user_id": "dz-%[1]d", "username": "Zoe", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	dave := fmt.Sprintf("dd-%d", suffix)
+
+	// openPR creates a PR and makes sure Dave is among its reviewers.
+	openPR := func(n int) string {
+		prID := fmt.Sprintf("decline-%d-%d", suffix, n)
+		prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Fix", "author_id": "da-%d"}`, prID, suffix)
+
+		resp, err := client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var prResp struct {
+			PR struct {
+				Reviewers []User `json:"assigned_reviewers"`
+			} `json:"pr"`
+		}
+		json.NewDecoder(resp.Body).Decode(&prResp)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated || len(prResp.PR.Reviewers) == 0 {
+			t.Fatalf("Failed to create PR: status %d, reviewers %+v", resp.StatusCode, prResp.PR.Reviewers)
+		}
+
+		for _, u := range prResp.PR.Reviewers {
+			if u.ID == dave {
+				return prID
+			}
+		}
+
+		reassignPayload := fmt.Sprintf(`{"pull_request_id": "%s", "old_user_id": "%s", "new_user_id": "%s", "reason": "other"}`, prID, prResp.PR.Reviewers[0].ID, dave)
+
+		resp, err = client.Post(baseURL+"/pullRequest/reassign", "application/json", bytes.NewBuffer([]byte(reassignPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to assign %s: %d", dave, resp.StatusCode)
+		}
+		return prID
+	}
+
+	decline := func(prID, reason string) (int, string, string) {
+		payload := fmt.Sprintf(`{"pull_request_id": "%s", "user_id": "%s", "reason": "%s", "comment": "busy"}`, prID, dave, reason)
+
+		resp, err := client.Post(baseURL+"/pullRequest/decline", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var declineResp struct {
+			ReplacedBy string `json:"replaced_by"`
+			Error      struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&declineResp)
+		return resp.StatusCode, declineResp.ReplacedBy, declineResp.Error.Code
+	}
+
+	t.Log("Step 1: Declining with an unknown reason")
+	first := openPR(0)
+	if status, _, code := decline(first, "bored"); status != http.StatusBadRequest || code != "INVALID_REASON" {
+		t.Errorf("Expected 400 INVALID_REASON, got %d %q", status, code)
+	}
+
+	t.Log("Step 2: Declining up to the daily limit picks replacements")
+	for n := 0; n < 3; n++ {
+		prID := first
+		if n > 0 {
+			prID = openPR(n)
+		}
+
+		status, replacedBy, code := decline(prID, "workload")
+		if status != http.StatusOK {
+			t.Fatalf("Decline %d failed: %d %q", n+1, status, code)
+		}
+		if replacedBy == "" || replacedBy == dave {
+			t.Errorf("Decline %d: unexpected replacement %q", n+1, replacedBy)
+		}
+	}
+
+	t.Log("Step 3: Stats count the declines")
+	resp, err = client.Get(baseURL + "/users/stats?user_id=" + dave)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statsResp struct {
+		Stats struct {
+			Declines        int `json:"declines"`
+			DeclinesLastDay int `json:"declines_last_day"`
+		} `json:"stats"`
+	}
+	json.NewDecoder(resp.Body).Decode(&statsResp)
+	resp.Body.Close()
+
+	if statsResp.Stats.Declines != 3 || statsResp.Stats.DeclinesLastDay != 3 {
+		t.Errorf("Expected 3 declines, got %+v", statsResp.Stats)
+	}
+
+	t.Log("Step 4: The next decline is over the limit")
+	if status, _, code := decline(openPR(3), "workload"); status != http.StatusTooManyRequests || code != "DECLINE_LIMIT" {
+		t.Errorf("Expected 429 DECLINE_LIMIT, got %d %q", status, code)
+	}
+}
+
+
+func TestPoolClaim(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "poolers-%[1]d",
+		"settings": {"reviewers_count": 2, "assignment_mode": "pool"},
+		"members": [
+			{"user_id": "pa-%[1]d", "username": "Alice", "is_active": true},
+			{"user_id": "pb-%[1]d", "username": "Bob", "is_active": true},
+			{"user_id": "pc-%[1]d", "username": "Carol", "is_active": true},
+			{"user_id": "pd-%[1]d", "username": "Dave", "is_active": true}
+		]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	outsiderPayload := fmt.Sprintf(`{"team_name": "outsiders-%[1]d", "members": [
+		{"user_id": "po-%[1]d", "username": "Oscar", "is_active": true}
+	]}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(outsiderPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	t.Log("Step 1: A PR in a pool team is created without reviewers")
+	prID := fmt.Sprintf("pool-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Fix", "author_id": "pa-%d"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prResp struct {
+		PR struct {
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&prResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || len(prResp.PR.Reviewers) != 0 {
+		t.Fatalf("Expected a PR without reviewers: status %d, reviewers %+v", resp.StatusCode, prResp.PR.Reviewers)
+	}
+
+	pooled := func() []string {
+		resp, err := client.Get(fmt.Sprintf("%s/pool/list?team_name=poolers-%d", baseURL, suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var listResp struct {
+			PRs []struct {
+				ID string `json:"pull_request_id"`
+			} `json:"pull_requests"`
+		}
+		json.NewDecoder(resp.Body).Decode(&listResp)
+
+		ids := make([]string, 0, len(listResp.PRs))
+		for _, pr := range listResp.PRs {
+			ids = append(ids, pr.ID)
+		}
+		return ids
+	}
+
+	if ids := pooled(); len(ids) != 1 || ids[0] != prID {
+		t.Fatalf("Expected %s in the pool, got %v", prID, ids)
+	}
+
+	claim := func(user string) (int, []User, string) {
+		payload := fmt.Sprintf(`{"pull_request_id": "%s", "user_id": "%s-%d"}`, prID, user, suffix)
+
+		resp, err := client.Post(baseURL+"/pool/claim", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var claimResp struct {
+			PR struct {
+				Reviewers []User `json:"assigned_reviewers"`
+			} `json:"pr"`
+			Error struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&claimResp)
+		return resp.StatusCode, claimResp.PR.Reviewers, claimResp.Error.Code
+	}
+
+	t.Log("Step 2: The author and members of other teams cannot claim")
+	for _, user := range []string{"pa", "po"} {
+		if status, _, code := claim(user); status != http.StatusConflict || code != "NOT_CANDIDATE" {
+			t.Errorf("Claim by %s: expected 409 NOT_CANDIDATE, got %d %q", user, status, code)
+		}
+	}
+
+	t.Log("Step 3: The first claim keeps the PR in the pool")
+	status, reviewers, code := claim("pb")
+	if status != http.StatusOK || len(reviewers) != 1 {
+		t.Fatalf("Claim failed: %d %q, reviewers %+v", status, code, reviewers)
+	}
+	if ids := pooled(); len(ids) != 1 {
+		t.Errorf("Expected the PR to stay in the pool, got %v", ids)
+	}
+
+	if status, _, code := claim("pb"); status != http.StatusConflict || code != "REVIEWER_ASSIGNED" {
+		t.Errorf("Expected 409 REVIEWER_ASSIGNED, got %d %q", status, code)
+	}
+
+	t.Log("Step 4: The last free slot takes the PR out of the pool")
+	status, reviewers, code = claim("pc")
+	if status != http.StatusOK || len(reviewers) != 2 {
+		t.Fatalf("Claim failed: %d %q, reviewers %+v", status, code, reviewers)
+	}
+	if ids := pooled(); len(ids) != 0 {
+		t.Errorf("Expected an empty pool, got %v", ids)
+	}
+
+	if status, _, code := claim("pd"); status != http.StatusConflict || code != "NOT_IN_POOL" {
+		t.Errorf("Expected 409 NOT_IN_POOL, got %d %q", status, code)
+	}
+}
+
+
+func TestTeamMembershipAndRename(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "core-%[1]d", "members": [
+		{"user_id": "ca-%[1]d", "username": "Alice", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	t.Log("Step 1: Adding a member to the existing team")
+	addPayload := fmt.Sprintf(`{"team_name": "core-%[1]d", "members": [
+		{"user_id": "cb-%[1]d", "username": "Bob", "is_active": true}
+	]}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/addMembers", "application/json", bytes.NewBuffer([]byte(addPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Add members failed: %d", resp.StatusCode)
+	}
+
+	t.Log("Step 2: Renaming the team")
+	renamePayload := fmt.Sprintf(`{"team_name": "core-%[1]d", "new_name": "platform-%[1]d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/rename", "application/json", bytes.NewBuffer([]byte(renamePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Rename failed: %d", resp.StatusCode)
+	}
+
+	t.Log("Step 3: Removing a member from the renamed team")
+	removePayload := fmt.Sprintf(`{"team_name": "platform-%[1]d", "user_id": "cb-%[1]d", "review_policy": "reassign"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/removeMember", "application/json", bytes.NewBuffer([]byte(removePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var removeResp struct {
+		Team struct {
+			Members []User `json:"members"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&removeResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Remove member failed: %d", resp.StatusCode)
+	}
+	if len(removeResp.Team.Members) != 1 || removeResp.Team.Members[0].ID != fmt.Sprintf("ca-%d", suffix) {
+		t.Errorf("Unexpected members after removal: %+v", removeResp.Team.Members)
+	}
+}
+
+
+func TestRemoveMemberReviewPolicies(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	teamPayload := fmt.Sprintf(`{"team_name": "leavers-%[1]d", "members": [
+		{"user_id": "la-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "lb-%[1]d", "username": "Bob", "is_active": true},
+		{"user_id": "lc-%[1]d", "username": "Carol", "is_active": true},
+		{"user_id": "ld-%[1]d", "username": "Dave", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(teamPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	prID := fmt.Sprintf("pr-leave-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Refactor", "author_id": "la-%d"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var createResp struct {
+		PR struct {
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&createResp)
+	resp.Body.Close()
+
+	if len(createResp.PR.Reviewers) != 2 {
+		t.Fatalf("Expected 2 reviewers, got %v", createResp.PR.Reviewers)
+	}
+	kept, moved := createResp.PR.Reviewers[0].ID, createResp.PR.Reviewers[1].ID
+
+	spare := ""
+	for _, id := range []string{"lb", "lc", "ld"} {
+		id = fmt.Sprintf("%s-%d", id, suffix)
+		if id != kept && id != moved {
+			spare = id
+		}
+	}
+
+	type removeResponse struct {
+		Reassigned []struct {
+			OldUserID string `json:"old_user_id"`
+			NewUserID string `json:"new_user_id"`
+		} `json:"reassigned"`
+	}
+
+	remove := func(userID, policy string) removeResponse {
+		payload := fmt.Sprintf(`{"team_name": "leavers-%d", "user_id": "%s", "review_policy": "%s"}`, suffix, userID, policy)
+
+		resp, err := client.Post(baseURL+"/team/removeMember", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Remove member failed: %d", resp.StatusCode)
+		}
+
+		var r removeResponse
+		json.NewDecoder(resp.Body).Decode(&r)
+		return r
+	}
+
+	reviewers := func() []string {
+		resp, err := client.Get(baseURL + "/pullRequest/get?pull_request_id=" + prID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var getResp struct {
+			PR struct {
+				Reviewers []User `json:"assigned_reviewers"`
+			} `json:"pr"`
+		}
+		json.NewDecoder(resp.Body).Decode(&getResp)
+
+		ids := make([]string, 0, len(getResp.PR.Reviewers))
+		for _, u := range getResp.PR.Reviewers {
+			ids = append(ids, u.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	t.Log("Step 1: Removing a reviewer with the keep policy")
+	if r := remove(kept, "keep"); len(r.Reassigned) != 0 {
+		t.Errorf("Expected no reassignments, got %+v", r.Reassigned)
+	}
+
+	want := []string{kept, moved}
+	sort.Strings(want)
+	if got := reviewers(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected reviewers %v after keep, got %v", want, got)
+	}
+
+	t.Log("Step 2: Removing a reviewer with the reassign policy")
+	r := remove(moved, "reassign")
+	if len(r.Reassigned) != 1 || r.Reassigned[0].OldUserID != moved || r.Reassigned[0].NewUserID != spare {
+		t.Errorf("Expected %s replaced by %s, got %+v", moved, spare, r.Reassigned)
+	}
+
+	want = []string{kept, spare}
+	sort.Strings(want)
+	if got := reviewers(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected reviewers %v after reassign, got %v", want, got)
+	}
+}
+
+
+func TestTeamArchiveAndDelete(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	t.Log("Step 1: Creating a team to retire and a team to take over")
+	oldPayload := fmt.Sprintf(`{"team_name": "legacy-%[1]d", "members": [
+		{"user_id": "la-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "lb-%[1]d", "username": "Bob", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(oldPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	newPayload := fmt.Sprintf(`{"team_name": "modern-%[1]d", "members": [
+		{"user_id": "lc-%[1]d", "username": "Carol", "is_active": true}
+	]}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(newPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Team creation failed: %d", resp.StatusCode)
+	}
+
+	t.Log("Step 2: Archived team gets no new PRs")
+	legacyPayload := fmt.Sprintf(`{"team_name": "legacy-%d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/archive", "application/json", bytes.NewBuffer([]byte(legacyPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archiveResp struct {
+		Team struct {
+			ArchivedAt *time.Time `json:"archived_at"`
+		} `json:"team"`
+	}
+	json.NewDecoder(resp.Body).Decode(&archiveResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || archiveResp.Team.ArchivedAt == nil {
+		t.Fatalf("Archive failed: status %d, %+v", resp.StatusCode, archiveResp.Team)
+	}
+
+	prPayload := fmt.Sprintf(`{"pull_request_id": "arc-%[1]d", "pull_request_name": "Fix", "author_id": "la-%[1]d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 for a PR in an archived team, got %d", resp.StatusCode)
+	}
+
+	t.Log("Step 3: Unarchived team works again")
+	resp, err = client.Post(baseURL+"/team/unarchive", "application/json", bytes.NewBuffer([]byte(legacyPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveResp.Team.ArchivedAt = nil
+	json.NewDecoder(resp.Body).Decode(&archiveResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || archiveResp.Team.ArchivedAt != nil {
+		t.Fatalf("Unarchive failed: status %d, %+v", resp.StatusCode, archiveResp.Team)
+	}
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Failed to create PR after unarchive: status %d", resp.StatusCode)
+	}
+
+	t.Log("Step 4: Deleting a team in use without a target")
+	resp, err = client.Post(baseURL+"/team/delete", "application/json", bytes.NewBuffer([]byte(legacyPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errResp struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusConflict || errResp.Error.Code != "TEAM_IN_USE" {
+		t.Errorf("Expected 409 TEAM_IN_USE, got %d %q", resp.StatusCode, errResp.Error.Code)
+	}
+
+	t.Log("Step 5: Deleting into an archived target")
+	modernPayload := fmt.Sprintf(`{"team_name": "modern-%d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/archive", "application/json", bytes.NewBuffer([]byte(modernPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	deletePayload := fmt.Sprintf(`{"team_name": "legacy-%[1]d", "target_team": "modern-%[1]d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/delete", "application/json", bytes.NewBuffer([]byte(deletePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errResp.Error.Code = ""
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusConflict || errResp.Error.Code != "TEAM_ARCHIVED" {
+		t.Errorf("Expected 409 TEAM_ARCHIVED, got %d %q", resp.StatusCode, errResp.Error.Code)
+	}
+
+	t.Log("Step 6: Deleting with members and PRs moved to the target")
+	resp, err = client.Post(baseURL+"/team/unarchive", "application/json", bytes.NewBuffer([]byte(modernPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = client.Post(baseURL+"/team/delete", "application/json", bytes.NewBuffer([]byte(deletePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deleteResp struct {
+		MovedUsers []string `json:"moved_users"`
+		MovedPRs   []string `json:"moved_pull_requests"`
+	}
+	json.NewDecoder(resp.Body).Decode(&deleteResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Delete failed: %d", resp.StatusCode)
+	}
+	if len(deleteResp.MovedUsers) != 2 || len(deleteResp.MovedPRs) != 1 || deleteResp.MovedPRs[0] != fmt.Sprintf("arc-%d", suffix) {
+		t.Errorf("Unexpected moved users and PRs: %+v", deleteResp)
+	}
+
+	resp, err = client.Get(fmt.Sprintf("%s/team/get?team_name=legacy-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for the deleted team, got %d", resp.StatusCode)
+	}
+
+	resp, err = client.Get(fmt.Sprintf("%s/team/get?team_name=modern-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var team struct {
+		Members []User `json:"members"`
+	}
+	json.NewDecoder(resp.Body).Decode(&team)
+	resp.Body.Close()
+
+	if len(team.Members) != 3 {
+		t.Errorf("Expected 3 members in the target team, got %+v", team.Members)
+	}
+}
+
+
+func TestUserTransfer(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	t.Log("Step 1: Creating two teams and a PR with one reviewer")
+	srcPayload := fmt.Sprintf(`{"team_name": "src-%[1]d", "settings": {"reviewers_count": 1}, "members": [
+		{"user_id": "ta-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "tb-%[1]d", "username": "Bob", "is_active": true},
+		{"user_id": "tc-%[1]d", "username": "Carol", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(srcPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	dstPayload := fmt.Sprintf(`{"team_name": "dst-%[1]d", "members": [
+		{"user_id": "td-%[1]d", "username": "Dave", "is_active": true}
+	]}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(dstPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Team creation failed: %d", resp.StatusCode)
+	}
+
+	prID := fmt.Sprintf("tr-%d", suffix)
+	prPayload := fmt.Sprintf(`{"pull_request_id": "%s", "pull_request_name": "Fix", "author_id": "ta-%d"}`, prID, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prResp struct {
+		PR struct {
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&prResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated || len(prResp.PR.Reviewers) != 1 {
+		t.Fatalf("Failed to create PR: status %d, reviewers %+v", resp.StatusCode, prResp.PR.Reviewers)
+	}
+	reviewer := prResp.PR.Reviewers[0].ID
+
+	t.Log("Step 2: Rejecting unknown policies and transfers into the same team")
+	for _, payload := range []string{
+		fmt.Sprintf(`{"user_id": "%s", "team_name": "dst-%d", "review_policy": "drop"}`, reviewer, suffix),
+		fmt.Sprintf(`{"user_id": "%s", "team_name": "dst-%d", "pr_policy": "close"}`, reviewer, suffix),
+		fmt.Sprintf(`{"user_id": "%s", "team_name": "src-%d"}`, reviewer, suffix),
+	} {
+		resp, err = client.Post(baseURL+"/users/transfer", "application/json", bytes.NewBuffer([]byte(payload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", payload, resp.StatusCode)
+		}
+	}
+
+	t.Log("Step 3: Transferring the reviewer reassigns their review")
+	transferPayload := fmt.Sprintf(`{"user_id": "%s", "team_name": "dst-%d", "review_policy": "reassign"}`, reviewer, suffix)
+
+	resp, err = client.Post(baseURL+"/users/transfer", "application/json", bytes.NewBuffer([]byte(transferPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var transferResp struct {
+		User struct {
+			TeamName string `json:"team_name"`
+		} `json:"user"`
+		Reassigned []struct {
+			PRID      string `json:"pull_request_id"`
+			NewUserID string `json:"new_user_id"`
+		} `json:"reassigned"`
+		MovedPRs []string `json:"moved_pull_requests"`
+	}
+	json.NewDecoder(resp.Body).Decode(&transferResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Transfer failed: %d", resp.StatusCode)
+	}
+	if transferResp.User.TeamName != fmt.Sprintf("dst-%d", suffix) {
+		t.Errorf("Expected the reviewer in dst-%d, got %q", suffix, transferResp.User.TeamName)
+	}
+	if len(transferResp.Reassigned) != 1 || transferResp.Reassigned[0].PRID != prID ||
+		transferResp.Reassigned[0].NewUserID == reviewer || transferResp.Reassigned[0].NewUserID == fmt.Sprintf("ta-%d", suffix) {
+		t.Errorf("Unexpected reassignments: %+v", transferResp.Reassigned)
+	}
+
+	t.Log("Step 4: Transferring the author with their PR and keeping reviews")
+	authorPayload := fmt.Sprintf(`{"user_id": "ta-%[1]d", "team_name": "dst-%[1]d", "from_team": "src-%[1]d",
+		"review_policy": "keep", "pr_policy": "move"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/users/transfer", "application/json", bytes.NewBuffer([]byte(authorPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transferResp.Reassigned = nil
+	json.NewDecoder(resp.Body).Decode(&transferResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Author transfer failed: %d", resp.StatusCode)
+	}
+	if len(transferResp.Reassigned) != 0 || len(transferResp.MovedPRs) != 1 || transferResp.MovedPRs[0] != prID {
+		t.Errorf("Expected the PR moved and nothing reassigned, got %+v", transferResp)
+	}
+
+	resp, err = client.Get(baseURL + "/pullRequest/get?pull_request_id=" + prID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var getResp struct {
+		PR struct {
+			TeamName string `json:"team_name"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&getResp)
+	resp.Body.Close()
+
+	if getResp.PR.TeamName != fmt.Sprintf("dst-%d", suffix) {
+		t.Errorf("Expected the PR in dst-%d, got %q", suffix, getResp.PR.TeamName)
+	}
+
+	t.Log("Step 5: Reading the transfer history")
+	resp, err = client.Get(fmt.Sprintf("%s/users/transfers?user_id=ta-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var historyResp struct {
+		Transfers []struct {
+			FromTeam     string `json:"from_team"`
+			ToTeam       string `json:"to_team"`
+			ReviewPolicy string `json:"review_policy"`
+			PRPolicy     string `json:"pr_policy"`
+		} `json:"transfers"`
+	}
+	json.NewDecoder(resp.Body).Decode(&historyResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(historyResp.Transfers) != 1 {
+		t.Fatalf("Unexpected history: status %d, %+v", resp.StatusCode, historyResp.Transfers)
+	}
+	got := historyResp.Transfers[0]
+	if got.FromTeam != fmt.Sprintf("src-%d", suffix) || got.ToTeam != fmt.Sprintf("dst-%d", suffix) ||
+		got.ReviewPolicy != "keep" || got.PRPolicy != "move" {
+		t.Errorf("Unexpected transfer entry: %+v", got)
+	}
+
+	resp, err = client.Get(fmt.Sprintf("%s/users/transfers?user_id=nobody-%d", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown user, got %d", resp.StatusCode)
+	}
+}
+
+
+func TestMultiTeamMembership(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	t.Log("Step 1: Creating two teams sharing the author")
+	webPayload := fmt.Sprintf(`{"team_name": "web-%[1]d",
+		"settings": {"reviewers_count": 1, "assignment_strategy": "least_loaded"},
+		"members": [
+			{"user_id": "wa-%[1]d", "username": "Alice", "is_active": true},
+			{"user_id": "wb-%[1]d", "username": "Bob", "is_active": true, "weight": 1},
+			{"user_id": "wc-%[1]d", "username": "Carol", "is_active": true, "weight": 3}
+		]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(webPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Team creation failed: %d", resp.StatusCode)
+	}
+
+	mobilePayload := fmt.Sprintf(`{"team_name": "mobile-%[1]d", "members": [
+		{"user_id": "wa-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "md-%[1]d", "username": "Dave", "is_active": true}
+	]}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(mobilePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Second team creation failed: %d", resp.StatusCode)
+	}
+
+	t.Log("Step 2: Creating a PR in the author's second team")
+	prPayload := fmt.Sprintf(`{"pull_request_id": "mt-%[1]d", "pull_request_name": "Fix",
+		"author_id": "wa-%[1]d", "team_name": "mobile-%[1]d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prResp struct {
+		PR struct {
+			TeamName  string `json:"team_name"`
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&prResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Failed to create PR: status %d", resp.StatusCode)
+	}
+	if prResp.PR.TeamName != fmt.Sprintf("mobile-%d", suffix) {
+		t.Errorf("Expected PR in mobile-%d, got %q", suffix, prResp.PR.TeamName)
+	}
+	if len(prResp.PR.Reviewers) != 1 || prResp.PR.Reviewers[0].ID != fmt.Sprintf("md-%d", suffix) {
+		t.Errorf("Expected md-%d as the only reviewer, got %+v", suffix, prResp.PR.Reviewers)
+	}
+
+	t.Log("Step 3: Spreading PRs of the first team by weight")
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		prPayload := fmt.Sprintf(`{"pull_request_id": "ml-%[1]d-%[2]d", "pull_request_name": "Fix",
+			"author_id": "wa-%[1]d", "team_name": "web-%[1]d"}`, suffix, i)
+
+		resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var created struct {
+			PR struct {
+				Reviewers []User `json:"assigned_reviewers"`
+			} `json:"pr"`
+		}
+		json.NewDecoder(resp.Body).Decode(&created)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated || len(created.PR.Reviewers) != 1 {
+			t.Fatalf("Failed to create PR %d: status %d, reviewers %+v", i, resp.StatusCode, created.PR.Reviewers)
+		}
+		counts[created.PR.Reviewers[0].ID]++
+	}
+
+	// Open reviews per unit of weight even out at 1 for Bob and 3 for Carol.
+	if counts[fmt.Sprintf("wb-%d", suffix)] != 1 || counts[fmt.Sprintf("wc-%d", suffix)] != 3 {
+		t.Errorf("Expected 1 review for weight 1 and 3 for weight 3, got %v", counts)
+	}
+
+	t.Log("Step 4: Marking the second team's reviewer as onboarding")
+	onboardingPayload := fmt.Sprintf(`{"user_id": "md-%[1]d", "team_name": "mobile-%[1]d", "is_onboarding": true}`, suffix)
+
+	resp, err = client.Post(baseURL+"/users/setOnboarding", "application/json", bytes.NewBuffer([]byte(onboardingPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var userResp struct {
+		User struct {
+			IsOnboarding bool `json:"is_onboarding"`
+		} `json:"user"`
+	}
+	json.NewDecoder(resp.Body).Decode(&userResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || !userResp.User.IsOnboarding {
+		t.Errorf("Set onboarding failed: status %d, %+v", resp.StatusCode, userResp.User)
+	}
+}
+
+
+func TestParentTeamEscalation(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	t.Log("Step 1: Creating a parent team and a subteam with only the author")
+	parentPayload := fmt.Sprintf(`{"team_name": "fintech-%[1]d", "members": [
+		{"user_id": "fa-%[1]d", "username": "Alice", "is_active": true},
+		{"user_id": "fb-%[1]d", "username": "Bob", "is_active": true}
+	]}`, suffix)
+
+	resp, err := client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(parentPayload)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	resp.Body.Close()
+
+	childPayload := fmt.Sprintf(`{"team_name": "payments-%[1]d", "parent_team": "fintech-%[1]d", "members": [
+		{"user_id": "pa-%[1]d", "username": "Carol", "is_active": true}
+	]}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/add", "application/json", bytes.NewBuffer([]byte(childPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Subteam creation failed: %d", resp.StatusCode)
+	}
+
+	t.Log("Step 2: Creating a PR in the subteam")
+	prPayload := fmt.Sprintf(`{"pull_request_id": "esc-%[1]d", "pull_request_name": "Fix", "author_id": "pa-%[1]d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/pullRequest/create", "application/json", bytes.NewBuffer([]byte(prPayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prResp struct {
+		PR struct {
+			Reviewers []User `json:"assigned_reviewers"`
+		} `json:"pr"`
+	}
+	json.NewDecoder(resp.Body).Decode(&prResp)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Failed to create PR: status %d", resp.StatusCode)
+	}
+	if len(prResp.PR.Reviewers) != 2 {
+		t.Errorf("Expected 2 reviewers from the parent team, got %+v", prResp.PR.Reviewers)
+	}
+
+	t.Log("Step 3: Reading the subtree of the parent team")
+	resp, err = client.Get(fmt.Sprintf("%s/team/get?team_name=fintech-%d&subtree=true", baseURL, suffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tree struct {
+		Subteams []Team `json:"subteams"`
+		Summary  struct {
+			Members     int `json:"members"`
+			OpenReviews int `json:"open_reviews"`
+		} `json:"summary"`
+	}
+	json.NewDecoder(resp.Body).Decode(&tree)
+	resp.Body.Close()
+
+	if len(tree.Subteams) != 1 || tree.Summary.Members != 3 || tree.Summary.OpenReviews < 2 {
+		t.Errorf("Unexpected subtree: %+v", tree)
+	}
+
+	t.Log("Step 4: Putting the parent under its own subteam")
+	cyclePayload := fmt.Sprintf(`{"team_name": "fintech-%[1]d", "parent_team": "payments-%[1]d"}`, suffix)
+
+	resp, err = client.Post(baseURL+"/team/setParent", "application/json", bytes.NewBuffer([]byte(cyclePayload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a cycle, got %d", resp.StatusCode)
+	}
+}
+
+
+func TestSCIMProvisioning(t *testing.T) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	suffix := time.Now().UnixNano()
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, baseURL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/scim+json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		return resp
+	}
+
+	t.Log("Step 1: Provisioning two users")
+	for _, name := range []string{"Alice", "Bob"} {
+		userPayload := fmt.Sprintf(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+			"userName": "scim-%s-%d", "displayName": "%s", "active": true}`, name, suffix, name)
+
+		resp := do(http.MethodPost, "/scim/v2/Users", userPayload)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("User creation failed: %d", resp.StatusCode)
+		}
+	}
+
+	t.Log("Step 2: Creating a group and adding a member with PATCH")
+	groupPayload := fmt.Sprintf(`{"displayName": "scim-team-%[1]d", "members": [{"value": "scim-Alice-%[1]d"}]}`, suffix)
+
+	resp := do(http.MethodPost, "/scim/v2/Groups", groupPayload)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Group creation failed: %d", resp.StatusCode)
+	}
+
+	patchPayload := fmt.Sprintf(`{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "add", "path": "members", "value": [{"value": "scim-Bob-%d"}]}]}`, suffix)
+
+	resp = do(http.MethodPatch, fmt.Sprintf("/scim/v2/Groups/scim-team-%d", suffix), patchPayload)
+
+	var group struct {
+		Members []struct {
+			Value string `json:"value"`
+		} `json:"members"`
+	}
+	json.NewDecoder(resp.Body).Decode(&group)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(group.Members) != 2 {
+		t.Fatalf("Expected 2 members after PATCH, got %d: %+v", resp.StatusCode, group)
+	}
+
+	t.Log("Step 3: Deprovisioning Bob and filtering users")
+	resp = do(http.MethodPatch, fmt.Sprintf("/scim/v2/Users/scim-Bob-%d", suffix),
+		`{"Operations": [{"op": "replace", "value": {"active": false}}]}`)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Deprovisioning failed: %d", resp.StatusCode)
+	}
+
+	filter := url.QueryEscape(fmt.Sprintf(`userName sw "scim-" and userName ew "-%d" and active eq true`, suffix))
+	resp = do(http.MethodGet, "/scim/v2/Users?count=10&filter="+filter, "")
+
+	var list struct {
+		TotalResults int `json:"totalResults"`
+		Resources    []struct {
+			UserName string `json:"userName"`
+		} `json:"Resources"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+
+	if list.TotalResults != 1 || len(list.Resources) != 1 || list.Resources[0].UserName != fmt.Sprintf("scim-Alice-%d", suffix) {
+		t.Errorf("Expected only Alice to be active, got %+v", list)
+	}
+
+	t.Log("Step 4: Changing Alice's userName keeps her id")
+	resp = do(http.MethodPatch, fmt.Sprintf("/scim/v2/Users/scim-Alice-%d", suffix),
+		fmt.Sprintf(`{"Operations": [{"op": "replace", "path": "userName", "value": "alice.smith-%d"}]}`, suffix))
+
+	var user struct {
+		ID       string `json:"id"`
+		UserName string `json:"userName"`
+	}
+	json.NewDecoder(resp.Body).Decode(&user)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || user.ID != fmt.Sprintf("scim-Alice-%d", suffix) || user.UserName != fmt.Sprintf("alice.smith-%d", suffix) {
+		t.Errorf("Unexpected user after the userName change: %d %+v", resp.StatusCode, user)
+	}
+
+	t.Log("Step 5: Renaming the group is rejected")
+	resp = do(http.MethodPatch, fmt.Sprintf("/scim/v2/Groups/scim-team-%d", suffix),
+		`{"Operations": [{"op": "replace", "path": "displayName", "value": "renamed"}]}`)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a group rename, got %d", resp.StatusCode)
+	}
+}
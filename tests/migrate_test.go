@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"ex8ed/pullreq-assigner/internal/storage"
+	"ex8ed/pullreq-assigner/migrations"
+)
+
+
+// Data of the baseline schema that the migrations have to carry over.
+const baselineData = `
+	INSERT INTO teams (name) VALUES ('backend');
+	INSERT INTO users (id, username, is_active, team_name) VALUES
+		('u1', 'Alice', TRUE, 'backend'),
+		('u2', 'Bob', TRUE, 'backend');
+	INSERT INTO pull_requests (id, name, author_id) VALUES ('pr-1', 'Fix', 'u1');
+	INSERT INTO pr_reviewers (pull_request_id, user_id) VALUES ('pr-1', 'u2');
+`
+
+
+// migratedSchema creates a schema of its own, runs script in it and migrates
+// it, twice to make sure a migrated database is left as it is.
+func migratedSchema(t *testing.T, name, script string) *sqlx.DB {
+	ctx := context.Background()
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		dbURL = defaultDatabaseURL
+	}
+
+	admin, err := sqlx.Connect("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	if _, err := admin.Exec("CREATE SCHEMA " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + name + " CASCADE") })
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", name)
+	u.RawQuery = q.Encode()
+
+	db, err := sqlx.Connect("postgres", u.String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(script); err != nil {
+		t.Fatalf("Failed to create the schema: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := storage.New(db).Migrate(ctx); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+	}
+	return db
+}
+
+
+// describeSchema lists the columns, constraints, indexes and applied
+// migrations of the schema db works in.
+func describeSchema(t *testing.T, db *sqlx.DB, name string) []string {
+	queries := []string{
+		`SELECT table_name || '.' || column_name || ' ' || data_type || COALESCE('(' || character_maximum_length || ')', '')
+			|| ' nullable=' || is_nullable || ' default=' || COALESCE(column_default, '')
+		FROM information_schema.columns WHERE table_schema = current_schema()`,
+		`SELECT conrelid::regclass::text || ' ' || conname || ' ' || pg_get_constraintdef(oid)
+		FROM pg_constraint WHERE connamespace = (SELECT oid FROM pg_namespace WHERE nspname = current_schema())`,
+		`SELECT indexdef FROM pg_indexes WHERE schemaname = current_schema()`,
+		`SELECT 'migration ' || name FROM schema_migrations`,
+	}
+
+	items := make([]string, 0)
+	for _, query := range queries {
+		var rows []string
+		if err := db.Select(&rows, query); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			items = append(items, strings.ReplaceAll(row, name+".", ""))
+		}
+	}
+	sort.Strings(items)
+	return items
+}
+
+
+func TestMigrateFromBaseline(t *testing.T) {
+	suffix := time.Now().UnixNano()
+
+	baseline, err := os.ReadFile("testdata/init_baseline.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := migrations.FS.ReadFile("init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("Step 1: Migrating a database created by the baseline init.sql")
+	baselineSchema := fmt.Sprintf("migrate_baseline_%d", suffix)
+	fromBaseline := migratedSchema(t, baselineSchema, string(baseline)+baselineData)
+
+	t.Log("Step 2: Migrating a database created by the current init.sql")
+	headSchema := fmt.Sprintf("migrate_head_%d", suffix)
+	fromHead := migratedSchema(t, headSchema, string(head))
+
+	t.Log("Step 3: Comparing the schemas")
+	want := map[string]bool{}
+	for _, item := range describeSchema(t, fromHead, headSchema) {
+		want[item] = true
+	}
+	got := map[string]bool{}
+	for _, item := range describeSchema(t, fromBaseline, baselineSchema) {
+		got[item] = true
+		if !want[item] {
+			t.Errorf("Unexpected after migration: %s", item)
+		}
+	}
+	for item := range want {
+		if !got[item] {
+			t.Errorf("Missing after migration: %s", item)
+		}
+	}
+
+	t.Log("Step 4: Checking the migrated data")
+	var prTeam string
+	if err := fromBaseline.Get(&prTeam, "SELECT team_name FROM pull_requests WHERE id = 'pr-1'"); err != nil {
+		t.Fatal(err)
+	}
+	if prTeam != "backend" {
+		t.Errorf("Expected the PR in the author's team, got %q", prTeam)
+	}
+
+	var members []string
+	if err := fromBaseline.Select(&members, "SELECT user_id FROM team_members WHERE team_name = 'backend' ORDER BY user_id"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(members, ",") != "u1,u2" {
+		t.Errorf("Expected members u1,u2, got %v", members)
+	}
+
+	var reviewers []string
+	if err := fromBaseline.Select(&reviewers, "SELECT user_id FROM pr_reviewers WHERE pull_request_id = 'pr-1' AND state = 'PENDING'"); err != nil {
+		t.Fatal(err)
+	}
+	if len(reviewers) != 1 || reviewers[0] != "u2" {
+		t.Errorf("Expected u2 pending review, got %v", reviewers)
+	}
+}